@@ -11,11 +11,18 @@ import (
 	"time"
 
 	"subscription-tracker/internal/cache"
+	"subscription-tracker/internal/catalog"
 	"subscription-tracker/internal/database"
-	"subscription-tracker/internal/handlers"
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/idempotency"
 	"subscription-tracker/internal/middleware"
+	"subscription-tracker/internal/passkey"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/ratelimit"
 	"subscription-tracker/internal/redis"
 	"subscription-tracker/internal/scheduler"
+	"subscription-tracker/internal/stream"
+	"subscription-tracker/internal/webhook"
 	"subscription-tracker/internal/worker"
 
 	"github.com/gorilla/mux"
@@ -66,8 +73,33 @@ func main() {
 		defer cacheWorker.Stop()
 	}
 
-	// Initialize scheduler for email alerts
-	scheduler.InitScheduler(db)
+	// Initialize service catalog
+	serviceCatalog, err := catalog.NewCatalog(db)
+	if err != nil {
+		log.Fatal("Failed to initialize service catalog:", err)
+	}
+
+	// Initialize event bus and webhook deliveries
+	bus := events.NewBus()
+	webhookDispatcher := webhook.NewDispatcher(db)
+	bus.Subscribe(webhookDispatcher.Handle)
+	webhookDispatcher.Start()
+	defer webhookDispatcher.Stop()
+
+	// Initialize event streams, fanned out through Redis when it is available
+	hub := stream.NewHub(redisClient)
+	bus.Subscribe(hub.Handle)
+	hub.Start()
+	defer hub.Stop()
+
+	// Initialize scheduler for email alerts and renewal webhooks
+	scheduler.InitScheduler(db, bus)
+
+	// Initialize idempotency key storage
+	idempotencyStore := idempotency.NewStore(redisClient, db)
+
+	// Initialize rate limits, shared through Redis when it is available
+	limiter := ratelimit.NewLimiter(redisClient)
 
 	// GoogleOAuth
 	googleOauthConfig := &oauth2.Config{
@@ -78,29 +110,19 @@ func main() {
 		Endpoint:     google.Endpoint,
 	}
 
+	// Passkeys
+	webAuthn, err := passkey.New(passkey.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("Failed to initialize passkeys:", err)
+	}
+
 	// Set up routes
 	router := mux.NewRouter()
+	router.NotFoundHandler = problem.NotFoundHandler()
+	router.MethodNotAllowedHandler = problem.MethodNotAllowedHandler()
 	basePath := "/api/v1"
 
-	// Public routes
-	router.HandleFunc(basePath+"/register", handlers.Register(db)).Methods("POST")
-	router.HandleFunc(basePath+"/login", handlers.Login(db)).Methods("POST")
-	router.HandleFunc(basePath+"/auth/google", handlers.AuthGoogle(db, googleOauthConfig)).Methods("POST")
-	router.HandleFunc(basePath+"/refresh", handlers.GenerateAccessToken(db)).Methods("POST")
-	router.HandleFunc(basePath+"/logout", handlers.LogoutHandler).Methods("POST")
-
-	// Protected routes (require authentication)
-	authRouter := router.PathPrefix("/").Subrouter()
-	authRouter.Use(middleware.AuthMiddleware(db))
-
-	// Porotected routes
-	authRouter.HandleFunc(basePath+"/subscriptions/stats", handlers.GetUserSubscriptionsStats(db)).Methods("GET")
-	authRouter.HandleFunc(basePath+"/detail", handlers.GetUserDetail(db)).Methods("GET")
-	authRouter.HandleFunc(basePath+"/subscriptions", handlers.GetSubscriptions(db, cacheService)).Methods("GET")
-	authRouter.HandleFunc(basePath+"/subscriptions", handlers.CreateSubscription(db, cacheService)).Methods("POST")
-	authRouter.HandleFunc(basePath+"/subscriptions/{id}", handlers.GetSubscription(db)).Methods("GET")
-	authRouter.HandleFunc(basePath+"/subscriptions/{id}", handlers.UpdateSubscription(db, cacheService)).Methods("PUT")
-	authRouter.HandleFunc(basePath+"/subscriptions/{id}", handlers.DeleteSubscription(db, cacheService)).Methods("DELETE")
+	registerRoutes(router, basePath, db, cacheService, serviceCatalog, googleOauthConfig, bus, webhookDispatcher, idempotencyStore, hub, limiter, webAuthn)
 
 	// Cache management endpoints (for debugging)
 	if cacheService != nil {
@@ -168,14 +190,15 @@ func main() {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "https://subscription-tracker-gamma.vercel.app", "https://www.subtrack.sbs"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Requested-With"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Requested-With", "X-Request-ID", "Idempotency-Key", "If-None-Match", "If-Modified-Since", "If-Match"},
+		ExposedHeaders:   []string{"X-Request-ID", "Idempotent-Replayed", "ETag", "Last-Modified", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           3600,
 		Debug:            os.Getenv("ENV") != "production", // Enable debug in development
 	})
 
-	// Wrap the router with CORS middleware
-	handler := c.Handler(router)
+	// Wrap the router with request IDs and CORS middleware
+	handler := c.Handler(middleware.RequestID(router))
 
 	// Start server
 	server := &http.Server{
@@ -219,7 +242,7 @@ func testSMTPPort(host, port string) {
 		defer tlsConn.Close()
 
 		fmt.Printf("  TLS handshake successful\n")
-		fmt.Printf("  Connection encrypted with: %s\n", tlsConn.ConnectionState().CipherSuite)
+		fmt.Printf("  Connection encrypted with: %s\n", tls.CipherSuiteName(tlsConn.ConnectionState().CipherSuite))
 	}
 
 	// Try to read SMTP banner
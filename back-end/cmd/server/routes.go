@@ -0,0 +1,118 @@
+package main
+
+import (
+	"subscription-tracker/internal/cache"
+	"subscription-tracker/internal/catalog"
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/handlers"
+	"subscription-tracker/internal/idempotency"
+	"subscription-tracker/internal/middleware"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/ratelimit"
+	"subscription-tracker/internal/stream"
+	"subscription-tracker/internal/webhook"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/mux"
+	"golang.org/x/oauth2"
+)
+
+// registerRoutes mounts the API under basePath. Every route added here must
+// also be documented in internal/openapi/openapi.json.
+func registerRoutes(router *mux.Router, basePath string, db models.Database, cacheService *cache.CacheService, serviceCatalog *catalog.Catalog, googleOauthConfig *oauth2.Config, bus *events.Bus, dispatcher *webhook.Dispatcher, idempotencyStore *idempotency.Store, hub *stream.Hub, limiter *ratelimit.Limiter, webAuthn *webauthn.WebAuthn) {
+	// Public routes
+	router.HandleFunc(basePath+"/register", handlers.Register(db)).Methods("POST")
+	router.HandleFunc(basePath+"/login", handlers.Login(db)).Methods("POST")
+	router.HandleFunc(basePath+"/login/2fa", handlers.VerifyLoginChallenge(db, limiter)).Methods("POST")
+	router.HandleFunc(basePath+"/passkeys/login/begin", handlers.BeginPasskeyLogin(db, webAuthn, limiter)).Methods("POST")
+	router.HandleFunc(basePath+"/passkeys/login/finish", handlers.FinishPasskeyLogin(db, webAuthn)).Methods("POST")
+	router.HandleFunc(basePath+"/auth/google", handlers.AuthGoogle(db, googleOauthConfig)).Methods("POST")
+	router.HandleFunc(basePath+"/refresh", handlers.GenerateAccessToken(db)).Methods("POST")
+	router.HandleFunc(basePath+"/logout", handlers.LogoutHandler(db)).Methods("POST")
+	router.HandleFunc(basePath+"/verify-email", handlers.VerifyEmail(db)).Methods("POST")
+	router.HandleFunc(basePath+"/password/forgot", handlers.ForgotPassword(db, limiter)).Methods("POST")
+	router.HandleFunc(basePath+"/password/reset", handlers.ResetPassword(db)).Methods("POST")
+	router.HandleFunc(basePath+"/profile/email/confirm", handlers.ConfirmEmailChange(db)).Methods("POST")
+	router.HandleFunc(basePath+"/openapi.json", handlers.GetOpenAPISpec()).Methods("GET")
+	router.HandleFunc(basePath+"/docs", handlers.GetAPIDocs()).Methods("GET")
+	router.HandleFunc(basePath+"/calendar/feed/{token}.ics", handlers.GetCalendarFeed(db)).Methods("GET")
+
+	// The event stream also accepts a stream token, as EventSource can't send
+	// an Authorization header
+	router.Handle(basePath+"/events", middleware.EventStreamAuth(db)(handlers.StreamEvents(hub))).Methods("GET")
+
+	// Protected routes (require authentication)
+	authRouter := router.PathPrefix("/").Subrouter()
+	authRouter.Use(middleware.AuthMiddleware(db))
+
+	// Only subscription writes take Idempotency-Key. Stored responses are kept
+	// in plain text, so routes that return secrets must not be wrapped.
+	idempotent := middleware.Idempotency(idempotencyStore)
+
+	// Porotected routes
+	authRouter.HandleFunc(basePath+"/subscriptions/stats", handlers.GetUserSubscriptionsStats(db, cacheService)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/detail", handlers.GetUserDetail(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/verify-email/resend", handlers.ResendVerificationEmail(limiter)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/profile", handlers.UpdateProfile(db)).Methods("PUT")
+	authRouter.HandleFunc(basePath+"/profile/password", handlers.ChangePassword(db)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/profile/email", handlers.RequestEmailChange(db, limiter)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/account/export", handlers.ExportAccount(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/account", handlers.DeleteAccount(db, googleOauthConfig)).Methods("DELETE")
+	authRouter.HandleFunc(basePath+"/subscriptions", handlers.GetSubscriptions(db, cacheService)).Methods("GET")
+	authRouter.Handle(basePath+"/subscriptions", idempotent(handlers.CreateSubscription(db, serviceCatalog, bus))).Methods("POST")
+	authRouter.HandleFunc(basePath+"/subscriptions/export", handlers.ExportSubscriptions(db)).Methods("GET")
+	authRouter.Handle(basePath+"/subscriptions/import", idempotent(handlers.ImportSubscriptions(db, bus))).Methods("POST")
+	authRouter.Handle(basePath+"/subscriptions/batch", idempotent(handlers.BatchSubscriptions(db, serviceCatalog, bus))).Methods("POST")
+	authRouter.HandleFunc(basePath+"/statements/analyze", handlers.AnalyzeStatement(db)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/subscriptions/{id}", handlers.GetSubscription(db)).Methods("GET")
+	authRouter.Handle(basePath+"/subscriptions/{id}", idempotent(handlers.UpdateSubscription(db, serviceCatalog, bus))).Methods("PUT")
+	authRouter.Handle(basePath+"/subscriptions/{id}", idempotent(handlers.PatchSubscription(db, bus))).Methods("PATCH")
+	authRouter.Handle(basePath+"/subscriptions/{id}", idempotent(handlers.DeleteSubscription(db, bus))).Methods("DELETE")
+
+	// Analytics routes
+	authRouter.HandleFunc(basePath+"/analytics/trend", handlers.GetSpendingTrend(db, cacheService)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/analytics/breakdown", handlers.GetSpendingBreakdown(db, cacheService)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/analytics/forecast", handlers.GetSpendingForecast(db, cacheService)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/catalog", handlers.SearchCatalog(serviceCatalog)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/catalog/{id}", handlers.GetCatalogService(serviceCatalog)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/insights/duplicates", handlers.GetDuplicateInsights(db, serviceCatalog)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/calendar", handlers.GetCalendar(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/calendar/feed", handlers.RotateCalendarFeed(db)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/calendar/feed", handlers.RevokeCalendarFeed(db)).Methods("DELETE")
+
+	// Webhook routes
+	authRouter.HandleFunc(basePath+"/webhooks", handlers.GetWebhooks(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/webhooks", handlers.CreateWebhook(db)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/webhooks/{id}", handlers.GetWebhook(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/webhooks/{id}", handlers.UpdateWebhook(db)).Methods("PUT")
+	authRouter.HandleFunc(basePath+"/webhooks/{id}", handlers.DeleteWebhook(db)).Methods("DELETE")
+	authRouter.HandleFunc(basePath+"/webhooks/{id}/deliveries", handlers.GetWebhookDeliveries(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/webhooks/{id}/deliveries/{deliveryId}/replay", handlers.ReplayWebhookDelivery(db, dispatcher)).Methods("POST")
+
+	// Sessions
+	authRouter.HandleFunc(basePath+"/sessions", handlers.GetSessions(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/sessions/revoke-others", handlers.RevokeOtherSessions(db)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/sessions/{id}", handlers.RevokeSession(db)).Methods("DELETE")
+
+	// Two-factor authentication
+	authRouter.HandleFunc(basePath+"/2fa", handlers.GetTwoFactorStatus(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/2fa/totp", handlers.EnrollTOTP(db)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/2fa/totp/confirm", handlers.ConfirmTOTP(db)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/2fa/totp", handlers.DisableTOTP(db, googleOauthConfig)).Methods("DELETE")
+	authRouter.HandleFunc(basePath+"/2fa/recovery-codes", handlers.RegenerateRecoveryCodes(db)).Methods("POST")
+
+	// Passkeys
+	authRouter.HandleFunc(basePath+"/passkeys", handlers.GetPasskeys(db)).Methods("GET")
+	authRouter.HandleFunc(basePath+"/passkeys/register/begin", handlers.BeginPasskeyRegistration(db, webAuthn)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/passkeys/register/finish", handlers.FinishPasskeyRegistration(db, webAuthn)).Methods("POST")
+	authRouter.HandleFunc(basePath+"/passkeys/{id}", handlers.DeletePasskey(db)).Methods("DELETE")
+
+	// Event stream
+	authRouter.HandleFunc(basePath+"/events/token", handlers.IssueStreamToken()).Methods("POST")
+
+	// Admin routes
+	adminRouter := authRouter.PathPrefix(basePath + "/admin").Subrouter()
+	adminRouter.Use(middleware.AdminMiddleware())
+	adminRouter.HandleFunc("/catalog/{id}", handlers.SaveCatalogService(serviceCatalog)).Methods("PUT")
+	adminRouter.HandleFunc("/catalog/{id}", handlers.DeleteCatalogService(serviceCatalog)).Methods("DELETE")
+}
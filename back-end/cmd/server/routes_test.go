@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"subscription-tracker/internal/openapi"
+
+	"github.com/gorilla/mux"
+)
+
+const testBasePath = "/api/v1"
+
+// TestOpenAPICoversRoutes fails when a route is registered without being
+// documented in the OpenAPI spec, or documented without being registered
+func TestOpenAPICoversRoutes(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.1") {
+		t.Fatalf("openapi version = %q, want 3.1.x", spec.OpenAPI)
+	}
+
+	documented := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	router := mux.NewRouter()
+	registerRoutes(router, testBasePath, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	registered := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouter prefixes have no methods of their own
+			return nil
+		}
+		for _, method := range methods {
+			registered[method+" "+strings.TrimPrefix(path, testBasePath)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking routes: %v", err)
+	}
+
+	if missing := difference(registered, documented); len(missing) > 0 {
+		t.Errorf("routes missing from internal/openapi/openapi.json:\n  %s", strings.Join(missing, "\n  "))
+	}
+	if stale := difference(documented, registered); len(stale) > 0 {
+		t.Errorf("documented operations without a route:\n  %s", strings.Join(stale, "\n  "))
+	}
+}
+
+func difference(a, b map[string]bool) []string {
+	var keys []string
+	for key := range a {
+		if !b[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,247 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"subscription-tracker/internal/billing"
+	"subscription-tracker/internal/models"
+)
+
+const (
+	monthLayout = "2006-01"
+	dateLayout  = "2006-01-02"
+)
+
+// ParseDate parses a YYYY-MM-DD string
+func ParseDate(value string) (time.Time, error) {
+	return time.Parse(dateLayout, value)
+}
+
+// ParseMonth parses a YYYY-MM string into the first day of that month
+func ParseMonth(value string) (time.Time, error) {
+	return time.Parse(monthLayout, value)
+}
+
+// MonthlyTrend returns the amount charged per month between the from and to
+// months (inclusive). There is no payment ledger, so past charges are
+// reconstructed by stepping each subscription's billing schedule back from its
+// next billing date, and only charges from its creation up to now are counted.
+// Inactive subscriptions stop counting at their last update.
+func MonthlyTrend(subscriptions []models.Subscription, from, to, now time.Time) models.SpendingTrend {
+	months := monthBuckets(from, to)
+	start := firstOfMonth(from)
+	end := lastOfMonth(to)
+
+	for _, sub := range subscriptions {
+		subStart := start
+		if sub.CreatedAt.After(subStart) {
+			subStart = sub.CreatedAt
+		}
+
+		subEnd := end
+		if now.Before(subEnd) {
+			subEnd = now
+		}
+		if !sub.IsActive && sub.UpdatedAt.Before(subEnd) {
+			subEnd = sub.UpdatedAt
+		}
+
+		for _, date := range billing.ScheduleBetween(sub.NextBillingDate, sub.BillingCycle, subStart, subEnd) {
+			addToMonth(months, date, sub.Price)
+		}
+	}
+
+	trend := models.SpendingTrend{
+		From:   start.Format(monthLayout),
+		To:     end.Format(monthLayout),
+		Months: months,
+	}
+	for i := range trend.Months {
+		trend.Months[i].Total = round(trend.Months[i].Total)
+		trend.Total += trend.Months[i].Total
+	}
+	trend.Total = round(trend.Total)
+
+	return trend
+}
+
+// Breakdown groups the monthly cost of active subscriptions by category and by
+// billing cycle
+func Breakdown(subscriptions []models.Subscription) models.SpendingBreakdown {
+	byCategory := map[string]*models.BreakdownItem{}
+	byCycle := map[string]*models.BreakdownItem{}
+	var total float64
+
+	for _, sub := range subscriptions {
+		if !sub.IsActive {
+			continue
+		}
+
+		cost := billing.MonthlyCost(sub.Price, sub.BillingCycle)
+		total += cost
+
+		addToGroup(byCategory, sub.Category, cost)
+		addToGroup(byCycle, sub.BillingCycle, cost)
+	}
+
+	return models.SpendingBreakdown{
+		TotalMonthly:   round(total),
+		ByCategory:     breakdownItems(byCategory, total),
+		ByBillingCycle: breakdownItems(byCycle, total),
+	}
+}
+
+// Forecast projects the charges of active subscriptions for the given number
+// of months, starting today and bucketed by calendar month
+func Forecast(subscriptions []models.Subscription, now time.Time, months int) models.SpendingForecast {
+	start := billing.Day(now)
+	endMonth := firstOfMonth(now).AddDate(0, months-1, 0)
+	buckets := monthBuckets(start, endMonth)
+	end := lastOfMonth(endMonth)
+
+	for _, sub := range subscriptions {
+		if !sub.IsActive {
+			continue
+		}
+
+		for _, date := range billing.Occurrences(sub.NextBillingDate, sub.BillingCycle, start, end) {
+			addToMonth(buckets, date, sub.Price)
+		}
+	}
+
+	forecast := models.SpendingForecast{
+		From:   start.Format(dateLayout),
+		To:     end.Format(dateLayout),
+		Months: buckets,
+	}
+	for i := range forecast.Months {
+		forecast.Months[i].Total = round(forecast.Months[i].Total)
+		forecast.Total += forecast.Months[i].Total
+	}
+	forecast.Total = round(forecast.Total)
+
+	return forecast
+}
+
+// ProjectCalendar expands the billing schedule of every active subscription
+// into the individual charges between from and to (inclusive). Only days with
+// at least one charge are returned, in date order, with a running total over
+// the whole window. Paused or cancelled subscriptions are left out.
+func ProjectCalendar(subscriptions []models.Subscription, from, to time.Time) models.Calendar {
+	days := map[string]*models.CalendarDay{}
+
+	for _, sub := range subscriptions {
+		if !sub.IsActive {
+			continue
+		}
+
+		for _, date := range billing.Occurrences(sub.NextBillingDate, sub.BillingCycle, from, to) {
+			key := date.Format(dateLayout)
+			day, ok := days[key]
+			if !ok {
+				day = &models.CalendarDay{Date: key}
+				days[key] = day
+			}
+
+			day.Total += sub.Price
+			day.Occurrences = append(day.Occurrences, models.CalendarOccurrence{
+				SubscriptionID: sub.ID,
+				Name:           sub.Name,
+				Category:       sub.Category,
+				BillingCycle:   sub.BillingCycle,
+				Amount:         sub.Price,
+			})
+		}
+	}
+
+	calendar := models.Calendar{
+		From: billing.Day(from).Format(dateLayout),
+		To:   billing.Day(to).Format(dateLayout),
+		Days: make([]models.CalendarDay, 0, len(days)),
+	}
+	for _, day := range days {
+		sort.Slice(day.Occurrences, func(i, j int) bool {
+			return day.Occurrences[i].SubscriptionID < day.Occurrences[j].SubscriptionID
+		})
+		calendar.Days = append(calendar.Days, *day)
+	}
+
+	// YYYY-MM-DD keys sort chronologically
+	sort.Slice(calendar.Days, func(i, j int) bool {
+		return calendar.Days[i].Date < calendar.Days[j].Date
+	})
+
+	var running float64
+	for i := range calendar.Days {
+		calendar.Days[i].Total = round(calendar.Days[i].Total)
+		running += calendar.Days[i].Total
+		calendar.Days[i].RunningTotal = round(running)
+	}
+	calendar.Total = round(running)
+
+	return calendar
+}
+
+// Helper functions
+func monthBuckets(from, to time.Time) []models.MonthlySpend {
+	months := []models.MonthlySpend{}
+	for month := firstOfMonth(from); !month.After(firstOfMonth(to)); month = month.AddDate(0, 1, 0) {
+		months = append(months, models.MonthlySpend{Month: month.Format(monthLayout)})
+	}
+	return months
+}
+
+func addToMonth(months []models.MonthlySpend, date time.Time, amount float64) {
+	key := date.Format(monthLayout)
+	for i := range months {
+		if months[i].Month == key {
+			months[i].Total += amount
+			months[i].Count++
+			return
+		}
+	}
+}
+
+func addToGroup(group map[string]*models.BreakdownItem, key string, cost float64) {
+	item, ok := group[key]
+	if !ok {
+		item = &models.BreakdownItem{Key: key}
+		group[key] = item
+	}
+	item.MonthlyCost += cost
+	item.Count++
+}
+
+func breakdownItems(group map[string]*models.BreakdownItem, total float64) []models.BreakdownItem {
+	items := make([]models.BreakdownItem, 0, len(group))
+	for _, item := range group {
+		if total > 0 {
+			item.Share = math.Round(item.MonthlyCost/total*10000) / 10000
+		}
+		item.MonthlyCost = round(item.MonthlyCost)
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].MonthlyCost != items[j].MonthlyCost {
+			return items[i].MonthlyCost > items[j].MonthlyCost
+		}
+		return items[i].Key < items[j].Key
+	})
+
+	return items
+}
+
+func firstOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func lastOfMonth(t time.Time) time.Time {
+	return firstOfMonth(t).AddDate(0, 1, -1)
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
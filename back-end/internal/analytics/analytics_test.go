@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+)
+
+// TestMonthlyTrendBeforeNextBillingDate rebuilds past charges of
+// subscriptions whose next billing date is after the trend range
+func TestMonthlyTrendBeforeNextBillingDate(t *testing.T) {
+	day := func(value string) time.Time {
+		date, err := ParseDate(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return date
+	}
+
+	now := day("2024-06-10")
+	subscriptions := []models.Subscription{
+		{
+			Name:            "Streaming",
+			Price:           10,
+			BillingCycle:    "monthly",
+			NextBillingDate: day("2024-06-15"),
+			IsActive:        true,
+			CreatedAt:       day("2024-02-01"),
+		},
+		{
+			Name:            "Storage",
+			Price:           120,
+			BillingCycle:    "yearly",
+			NextBillingDate: day("2025-03-20"),
+			IsActive:        true,
+			CreatedAt:       day("2023-01-01"),
+		},
+		{
+			Name:            "Gym",
+			Price:           30,
+			BillingCycle:    "monthly",
+			NextBillingDate: day("2024-07-05"),
+			IsActive:        false,
+			CreatedAt:       day("2023-01-01"),
+			UpdatedAt:       day("2024-03-10"),
+		},
+	}
+
+	trend := MonthlyTrend(subscriptions, day("2024-01-01"), day("2024-05-01"), now)
+
+	// Streaming is charged on the 15th from February, storage on March 20 and
+	// the gym on the 5th until it was cancelled in March
+	want := map[string]float64{
+		"2024-01": 30,
+		"2024-02": 40,
+		"2024-03": 160,
+		"2024-04": 10,
+		"2024-05": 10,
+	}
+	if len(trend.Months) != len(want) {
+		t.Fatalf("got %d months, want %d", len(trend.Months), len(want))
+	}
+	for _, month := range trend.Months {
+		if month.Total != want[month.Month] {
+			t.Errorf("%s: total %v, want %v", month.Month, month.Total, want[month.Month])
+		}
+	}
+	if trend.Total != 250 {
+		t.Errorf("total %v, want 250", trend.Total)
+	}
+}
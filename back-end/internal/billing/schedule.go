@@ -0,0 +1,140 @@
+package billing
+
+import (
+	"time"
+)
+
+// Supported billing cycles
+const (
+	CycleWeekly  = "weekly"
+	CycleMonthly = "monthly"
+	CycleYearly  = "yearly"
+)
+
+// AddCycles returns the date n billing periods after anchor. Monthly and yearly
+// cycles keep the anchor's day of month and fall back to the last day of
+// shorter months, so a subscription billed on the 31st is charged on Feb 28/29.
+func AddCycles(anchor time.Time, cycle string, n int) time.Time {
+	anchor = Day(anchor)
+
+	switch cycle {
+	case CycleWeekly:
+		return anchor.AddDate(0, 0, 7*n)
+	case CycleYearly:
+		return addMonthsClamped(anchor, 12*n)
+	default:
+		return addMonthsClamped(anchor, n)
+	}
+}
+
+// Occurrences returns every billing date of a subscription anchored at anchor
+// that falls within [from, to]. Dates before the anchor are never returned.
+func Occurrences(anchor time.Time, cycle string, from, to time.Time) []time.Time {
+	anchor = Day(anchor)
+	from = Day(from)
+	to = Day(to)
+
+	if to.Before(from) || to.Before(anchor) {
+		return nil
+	}
+
+	n := 0
+	if from.After(anchor) {
+		n = estimateCycles(anchor, cycle, from)
+		for n > 0 && !AddCycles(anchor, cycle, n-1).Before(from) {
+			n--
+		}
+		for AddCycles(anchor, cycle, n).Before(from) {
+			n++
+		}
+	}
+
+	var dates []time.Time
+	for date := AddCycles(anchor, cycle, n); !date.After(to); date = AddCycles(anchor, cycle, n) {
+		dates = append(dates, date)
+		n++
+	}
+
+	return dates
+}
+
+// ScheduleBetween returns every billing date within [from, to] of the schedule
+// running through anchor, in both directions. Earlier dates are found by
+// stepping whole cycles back from anchor, so they keep its day of month.
+func ScheduleBetween(anchor time.Time, cycle string, from, to time.Time) []time.Time {
+	anchor = Day(anchor)
+	from = Day(from)
+	to = Day(to)
+
+	if to.Before(from) {
+		return nil
+	}
+
+	var earlier []time.Time
+	for n := -1; ; n-- {
+		date := AddCycles(anchor, cycle, n)
+		if date.Before(from) {
+			break
+		}
+		if !date.After(to) {
+			earlier = append(earlier, date)
+		}
+	}
+
+	dates := make([]time.Time, 0, len(earlier))
+	for i := len(earlier) - 1; i >= 0; i-- {
+		dates = append(dates, earlier[i])
+	}
+
+	return append(dates, Occurrences(anchor, cycle, from, to)...)
+}
+
+// MonthlyCost normalizes a price charged once per cycle to a monthly amount
+func MonthlyCost(price float64, cycle string) float64 {
+	switch cycle {
+	case CycleWeekly:
+		return price * 52 / 12
+	case CycleYearly:
+		return price / 12
+	default:
+		return price
+	}
+}
+
+// Day truncates t to midnight UTC of its calendar date
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Helper functions
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month := t.Year(), int(t.Month())-1+months
+	year += month / 12
+	month %= 12
+	if month < 0 {
+		month += 12
+		year--
+	}
+
+	day := t.Day()
+	if last := daysIn(year, time.Month(month+1)); day > last {
+		day = last
+	}
+
+	return time.Date(year, time.Month(month+1), day, 0, 0, 0, 0, time.UTC)
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func estimateCycles(anchor time.Time, cycle string, target time.Time) int {
+	switch cycle {
+	case CycleWeekly:
+		return int(target.Sub(anchor).Hours()/24) / 7
+	case CycleYearly:
+		return target.Year() - anchor.Year()
+	default:
+		return (target.Year()-anchor.Year())*12 + int(target.Month()) - int(anchor.Month())
+	}
+}
@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"errors"
 	"log"
+	"time"
 
 	"subscription-tracker/internal/models"
 	"subscription-tracker/internal/redis"
@@ -19,12 +21,28 @@ func NewCacheService(redisClient *redis.RedisClient, db models.Database) *CacheS
 	}
 }
 
+// ErrStaleCache is returned for a cached entry stored under an older data
+// version than the one asked for
+var ErrStaleCache = errors.New("cached entry is older than the data version")
+
+// versionedSubscriptions is a cached subscription list together with the data
+// version it was read under
+type versionedSubscriptions struct {
+	Version       int64                 `json:"version"`
+	Subscriptions []models.Subscription `json:"subscriptions"`
+}
+
 // Subscription caching methods
-func (c *CacheService) CacheUserSubscriptions(userID int, subscriptions []models.Subscription) error {
+
+// CacheUserSubscriptions stores subscriptions read while the user's data was
+// at version. A write that lands between the read and this call bumps the
+// version, so the entry is never served under the newer one.
+func (c *CacheService) CacheUserSubscriptions(userID int, version time.Time, subscriptions []models.Subscription) error {
 	cacheKey := c.redisClient.GetUserSubscriptionsCacheKey(userID)
 	ttl := c.redisClient.GetCacheTTL()
 
-	err := c.redisClient.Set(cacheKey, subscriptions, ttl)
+	entry := versionedSubscriptions{Version: version.UnixNano(), Subscriptions: subscriptions}
+	err := c.redisClient.Set(cacheKey, entry, ttl)
 	if err != nil {
 		log.Printf("Failed to cache user subscriptions: %v", err)
 		return err
@@ -34,16 +52,21 @@ func (c *CacheService) CacheUserSubscriptions(userID int, subscriptions []models
 	return nil
 }
 
-func (c *CacheService) GetCachedUserSubscriptions(userID int) ([]models.Subscription, error) {
+// GetCachedUserSubscriptions returns the cached subscriptions if they were
+// stored under version, and ErrStaleCache otherwise
+func (c *CacheService) GetCachedUserSubscriptions(userID int, version time.Time) ([]models.Subscription, error) {
 	cacheKey := c.redisClient.GetUserSubscriptionsCacheKey(userID)
-	var subscriptions []models.Subscription
+	var entry versionedSubscriptions
 
-	err := c.redisClient.Get(cacheKey, &subscriptions)
+	err := c.redisClient.Get(cacheKey, &entry)
 	if err != nil {
 		return nil, err
 	}
+	if entry.Version != version.UnixNano() {
+		return nil, ErrStaleCache
+	}
 
-	return subscriptions, nil
+	return entry.Subscriptions, nil
 }
 
 func (c *CacheService) CacheUserStats(userID int, stats *models.SubscriptionStats) error {
@@ -72,28 +95,105 @@ func (c *CacheService) GetCachedUserStats(userID int) (*models.SubscriptionStats
 	return stats, nil
 }
 
+// Analytics responses are stored as fields of a single per-user hash so that
+// every variant (trend range, forecast, breakdown) is dropped in one delete
+func (c *CacheService) CacheUserAnalytics(userID int, name string, value interface{}) error {
+	cacheKey := c.redisClient.GetUserAnalyticsCacheKey(userID)
+	ttl := c.redisClient.GetCacheTTL()
+
+	err := c.redisClient.HSet(cacheKey, name, value, ttl)
+	if err != nil {
+		log.Printf("Failed to cache user analytics: %v", err)
+		return err
+	}
+
+	log.Printf("Cached %s analytics for user %d", name, userID)
+	return nil
+}
+
+func (c *CacheService) GetCachedUserAnalytics(userID int, name string, dest interface{}) error {
+	cacheKey := c.redisClient.GetUserAnalyticsCacheKey(userID)
+	return c.redisClient.HGet(cacheKey, name, dest)
+}
+
+// Data version methods
+
+// GetUserDataVersion returns the time the user's cached data was last
+// invalidated. It identifies the current state of the data and is used for
+// ETags and Last-Modified. A user without a version yet starts at now, so a
+// flushed Redis never brings back an old version.
+func (c *CacheService) GetUserDataVersion(userID int) (time.Time, error) {
+	cacheKey := c.redisClient.GetUserVersionCacheKey(userID)
+
+	var version int64
+	if err := c.redisClient.Get(cacheKey, &version); err == nil {
+		return time.Unix(0, version).UTC(), nil
+	}
+
+	if _, err := c.redisClient.SetNX(cacheKey, time.Now().UnixNano(), 0); err != nil {
+		return time.Time{}, err
+	}
+	if err := c.redisClient.Get(cacheKey, &version); err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, version).UTC(), nil
+}
+
+// bumpUserDataVersion runs after the cached data is deleted, so a reader
+// never pairs the new version with stale data
+func (c *CacheService) bumpUserDataVersion(userID int) {
+	cacheKey := c.redisClient.GetUserVersionCacheKey(userID)
+	if err := c.redisClient.Set(cacheKey, time.Now().UnixNano(), 0); err != nil {
+		log.Printf("Failed to bump data version for user %d: %v", userID, err)
+	}
+}
+
 // Invalidation methods
 func (c *CacheService) InvalidateUserSubscriptionsCache(userID int) error {
 	cacheKey := c.redisClient.GetUserSubscriptionsCacheKey(userID)
+	defer c.bumpUserDataVersion(userID)
 	return c.redisClient.Delete(cacheKey)
 }
 
 func (c *CacheService) InvalidateUserStatsCache(userID int) error {
 	cacheKey := c.redisClient.GetUserStatsCacheKey(userID)
+	defer c.bumpUserDataVersion(userID)
+	return c.redisClient.Delete(cacheKey)
+}
+
+func (c *CacheService) InvalidateUserAnalyticsCache(userID int) error {
+	cacheKey := c.redisClient.GetUserAnalyticsCacheKey(userID)
+	defer c.bumpUserDataVersion(userID)
 	return c.redisClient.Delete(cacheKey)
 }
 
+// InvalidateUserSubscriptionsAndStatsCache also drops analytics, which are
+// derived from subscriptions as well
 func (c *CacheService) InvalidateUserSubscriptionsAndStatsCache(userID int) error {
-	cacheKey := c.redisClient.GetUserSubscriptionsCacheKey(userID)
-	err := c.redisClient.Delete(cacheKey)
+	defer c.bumpUserDataVersion(userID)
+	return c.redisClient.Delete(
+		c.redisClient.GetUserSubscriptionsCacheKey(userID),
+		c.redisClient.GetUserStatsCacheKey(userID),
+		c.redisClient.GetUserAnalyticsCacheKey(userID),
+	)
+}
+
+// PurgeUser removes every key of a deleted user, including idempotency keys.
+// Unlike the invalidation methods it does not bump the data version, which
+// would leave a version key behind for a user that no longer exists.
+func (c *CacheService) PurgeUser(userID int) error {
+	err := c.redisClient.Delete(
+		c.redisClient.GetUserSubscriptionsCacheKey(userID),
+		c.redisClient.GetUserStatsCacheKey(userID),
+		c.redisClient.GetUserAnalyticsCacheKey(userID),
+		c.redisClient.GetUserVersionCacheKey(userID),
+	)
 	if err != nil {
 		return err
 	}
 
-	cacheKey = c.redisClient.GetUserStatsCacheKey(userID)
-	err = c.redisClient.Delete(cacheKey)
-
-	return err
+	return c.redisClient.DeleteMatching(c.redisClient.GetIdempotencyKey(userID, "*"))
 }
 
 // Check if cache exists
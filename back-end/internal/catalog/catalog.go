@@ -0,0 +1,239 @@
+package catalog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/validation"
+)
+
+//go:embed services.json
+var bundledServices []byte
+
+// Bundled returns the catalog shipped with the server
+func Bundled() ([]models.CatalogService, error) {
+	var services []models.CatalogService
+	if err := json.Unmarshal(bundledServices, &services); err != nil {
+		return nil, fmt.Errorf("invalid bundled catalog: %v", err)
+	}
+	return services, nil
+}
+
+// Catalog keeps the active catalog in memory for autocomplete. The database
+// is the source of truth; admin edits go through Save and Delete, which
+// reload the in-memory copy.
+type Catalog struct {
+	db       models.Database
+	mu       sync.RWMutex
+	services []models.CatalogService
+}
+
+func NewCatalog(db models.Database) (*Catalog, error) {
+	bundled, err := Bundled()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.SeedCatalogServices(bundled); err != nil {
+		return nil, fmt.Errorf("failed to seed catalog: %v", err)
+	}
+
+	c := &Catalog{db: db}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Catalog) Reload() error {
+	services, err := c.db.GetCatalogServices()
+	if err != nil {
+		return fmt.Errorf("failed to load catalog: %v", err)
+	}
+
+	c.mu.Lock()
+	c.services = services
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Search returns services whose name or aliases match query, best match first
+func (c *Catalog) Search(query string, limit int) []models.CatalogService {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	query = normalize(query)
+
+	type match struct {
+		service models.CatalogService
+		score   int
+	}
+
+	var matches []match
+	for _, service := range c.services {
+		score := matchScore(query, service.Name)
+		for _, alias := range service.Aliases {
+			// Alias hits rank just below equally good name hits
+			if aliasScore := matchScore(query, alias) - 5; aliasScore > score {
+				score = aliasScore
+			}
+		}
+		if query == "" || score > 0 {
+			matches = append(matches, match{service, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	results := []models.CatalogService{}
+	for _, m := range matches {
+		if limit > 0 && len(results) == limit {
+			break
+		}
+		results = append(results, m.service)
+	}
+
+	return results
+}
+
+func (c *Catalog) Service(id string) (models.CatalogService, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, service := range c.services {
+		if service.ID == id {
+			return service, true
+		}
+	}
+	return models.CatalogService{}, false
+}
+
+// Resolve finds the service a free-text subscription name refers to, by exact
+// match on its name or one of its aliases
+func (c *Catalog) Resolve(name string) (models.CatalogService, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	key := normalize(name)
+	if key == "" {
+		return models.CatalogService{}, false
+	}
+
+	for _, service := range c.services {
+		if normalize(service.Name) == key {
+			return service, true
+		}
+		for _, alias := range service.Aliases {
+			if normalize(alias) == key {
+				return service, true
+			}
+		}
+	}
+	return models.CatalogService{}, false
+}
+
+// Plan looks up a plan by its ID together with the service it belongs to
+func (c *Catalog) Plan(planID string) (models.CatalogService, models.CatalogPlan, bool) {
+	serviceID, _, _ := strings.Cut(planID, ":")
+
+	service, ok := c.Service(serviceID)
+	if !ok {
+		return models.CatalogService{}, models.CatalogPlan{}, false
+	}
+
+	for _, plan := range service.Plans {
+		if plan.ID == planID {
+			return service, plan, true
+		}
+	}
+	return models.CatalogService{}, models.CatalogPlan{}, false
+}
+
+func (c *Catalog) Save(service models.CatalogService) error {
+	if err := c.db.UpsertCatalogService(service); err != nil {
+		return err
+	}
+	return c.Reload()
+}
+
+func (c *Catalog) Delete(id string) error {
+	if err := c.db.DeleteCatalogService(id); err != nil {
+		return err
+	}
+	return c.Reload()
+}
+
+// Validate checks an admin-submitted service
+func Validate(service models.CatalogService) []models.FieldError {
+	errs := validation.Struct(service)
+
+	seen := map[string]bool{}
+	for i, plan := range service.Plans {
+		field := fmt.Sprintf("plans[%d].id", i)
+		if !strings.HasPrefix(plan.ID, service.ID+":") || len(plan.ID) == len(service.ID)+1 {
+			errs = append(errs, models.FieldError{
+				Field:   field,
+				Code:    "prefix",
+				Message: fmt.Sprintf("must look like %s:<plan>", service.ID),
+			})
+		}
+		if seen[plan.ID] {
+			errs = append(errs, models.FieldError{
+				Field:   field,
+				Code:    "unique",
+				Message: fmt.Sprintf("%q is duplicated", plan.ID),
+			})
+		}
+		seen[plan.ID] = true
+	}
+
+	return errs
+}
+
+// Helper functions
+func matchScore(query, candidate string) int {
+	candidate = normalize(candidate)
+	if query == "" || candidate == "" {
+		return 0
+	}
+
+	switch {
+	case candidate == query:
+		return 100
+	case strings.HasPrefix(candidate, query):
+		return 80
+	case strings.Contains(" "+candidate, " "+query):
+		// Prefix of a later word, e.g. "prime" in "amazon prime"
+		return 60
+	case strings.Contains(strings.ReplaceAll(candidate, " ", ""), strings.ReplaceAll(query, " ", "")):
+		return 30
+	default:
+		return 0
+	}
+}
+
+func normalize(value string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(strings.TrimSpace(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		case !space && b.Len() > 0:
+			b.WriteRune(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -2,9 +2,13 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"subscription-tracker/internal/cache"
 	"subscription-tracker/internal/models"
@@ -59,6 +63,16 @@ func InitDB(cacheService *cache.CacheService) (*DB, error) {
 		return nil, fmt.Errorf("failed to create users tablel: %v", err)
 	}
 
+	// Accounts that existed before email verification are treated as verified:
+	// the default only fills rows present when the column is added
+	_, err = db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+		ALTER TABLE users ALTER COLUMN email_verified_at DROP DEFAULT;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate users table: %v", err)
+	}
+
 	createTableSQL := `
 	CREATE TABLE IF NOT EXISTS subscriptions (
 		id SERIAL PRIMARY KEY,
@@ -83,6 +97,273 @@ func InitDB(cacheService *cache.CacheService) (*DB, error) {
 		return nil, fmt.Errorf("failed to create table: %v", err)
 	}
 
+	// version is bumped on every write and backs optimistic concurrency
+	_, err = db.Exec(`ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate subscriptions table: %v", err)
+	}
+
+	createCalendarFeedsTableSQL := `
+	CREATE TABLE IF NOT EXISTS calendar_feeds (
+		user_id INTEGER PRIMARY KEY,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	_, err = db.Exec(createCalendarFeedsTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar feeds table: %v", err)
+	}
+
+	createCatalogServicesTableSQL := `
+	CREATE TABLE IF NOT EXISTS catalog_services (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		aliases JSONB NOT NULL DEFAULT '[]',
+		category TEXT NOT NULL,
+		logo_key TEXT,
+		plans JSONB NOT NULL DEFAULT '[]',
+		is_active BOOLEAN DEFAULT true,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	_, err = db.Exec(createCatalogServicesTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create catalog services table: %v", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE catalog_services ADD COLUMN IF NOT EXISTS includes JSONB NOT NULL DEFAULT '[]'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate catalog services table: %v", err)
+	}
+
+	createWebhooksTableSQL := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events JSONB NOT NULL DEFAULT '[]',
+		is_active BOOLEAN DEFAULT true,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id SERIAL PRIMARY KEY,
+		webhook_id INTEGER NOT NULL,
+		CONSTRAINT fk_webhooks
+			FOREIGN KEY (webhook_id)
+			REFERENCES webhooks(id)
+			ON DELETE CASCADE,
+		event_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_status INTEGER,
+		last_error TEXT,
+		next_attempt_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		delivered_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+		ON webhook_deliveries (next_attempt_at)
+		WHERE status = 'pending';
+	`
+
+	_, err = db.Exec(createWebhooksTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhooks tables: %v", err)
+	}
+
+	createIdempotencyKeysTableSQL := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		user_id INTEGER NOT NULL,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		completed BOOLEAN NOT NULL DEFAULT false,
+		status_code INTEGER,
+		header JSONB,
+		body BYTEA,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, key)
+	);`
+
+	_, err = db.Exec(createIdempotencyKeysTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create idempotency keys table: %v", err)
+	}
+
+	createRefreshTokensTableSQL := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		family_id TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at TIMESTAMP NOT NULL,
+		rotated_at TIMESTAMP,
+		revoked_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family
+		ON refresh_tokens (family_id);
+	`
+
+	_, err = db.Exec(createRefreshTokensTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh tokens table: %v", err)
+	}
+
+	createSessionsTableSQL := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		family_id TEXT NOT NULL UNIQUE,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip_address TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		revoked_at TIMESTAMP
+	);
+	`
+
+	_, err = db.Exec(createSessionsTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sessions table: %v", err)
+	}
+
+	createPasswordResetTokensTableSQL := `
+	CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	_, err = db.Exec(createPasswordResetTokensTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create password reset tokens table: %v", err)
+	}
+
+	createUserTOTPTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_totp (
+		user_id INTEGER PRIMARY KEY,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		secret TEXT NOT NULL,
+		last_used_step BIGINT NOT NULL DEFAULT 0,
+		enabled_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	_, err = db.Exec(createUserTOTPTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user totp table: %v", err)
+	}
+
+	createRecoveryCodesTableSQL := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		code_hash TEXT NOT NULL,
+		used_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, code_hash)
+	);
+	`
+
+	_, err = db.Exec(createRecoveryCodesTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recovery codes table: %v", err)
+	}
+
+	// Random WebAuthn user handle, assigned when the user adds a first passkey
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS webauthn_id BYTEA UNIQUE`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate users table: %v", err)
+	}
+
+	createPasskeysTableSQL := `
+	CREATE TABLE IF NOT EXISTS passkeys (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		credential_id BYTEA NOT NULL UNIQUE,
+		name TEXT NOT NULL,
+		credential JSONB NOT NULL,
+		sign_count BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys(user_id);
+	`
+
+	_, err = db.Exec(createPasskeysTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create passkeys table: %v", err)
+	}
+
+	createWebAuthnCeremoniesTableSQL := `
+	CREATE TABLE IF NOT EXISTS webauthn_ceremonies (
+		id_hash TEXT PRIMARY KEY,
+		user_id INTEGER,
+		CONSTRAINT fk_users
+			FOREIGN KEY (user_id)
+			REFERENCES users(id)
+			ON DELETE CASCADE,
+		kind TEXT NOT NULL,
+		session JSONB NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+	`
+
+	_, err = db.Exec(createWebAuthnCeremoniesTableSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webauthn ceremonies table: %v", err)
+	}
+
 	log.Println("PostgreSQL database initialized successfully")
 	return db, nil
 }
@@ -103,6 +384,7 @@ func (db *DB) GetUserSubscriptions(userID int) ([]models.Subscription, error) {
 				s.is_active, 
 				s.created_at, 
 				s.updated_at,
+				s.version,
 				u.email
 			FROM subscriptions s
 			LEFT JOIN users u
@@ -129,6 +411,7 @@ func (db *DB) GetUserSubscriptions(userID int) ([]models.Subscription, error) {
 			&sub.IsActive,
 			&sub.CreatedAt,
 			&sub.UpdatedAt,
+			&sub.Version,
 			&sub.Email,
 		)
 		if err != nil {
@@ -152,6 +435,8 @@ func (db *DB) GetSubscriptionByID(id int) (*models.Subscription, error) {
 				s.is_active, 
 				s.created_at, 
 				s.updated_at,
+				s.version,
+				s.user_id,
 				u.email
 			FROM subscriptions s
 			LEFT JOIN users u
@@ -171,6 +456,8 @@ func (db *DB) GetSubscriptionByID(id int) (*models.Subscription, error) {
 		&sub.IsActive,
 		&sub.CreatedAt,
 		&sub.UpdatedAt,
+		&sub.Version,
+		&sub.UserID,
 		&sub.Email,
 	)
 	if err != nil {
@@ -181,20 +468,86 @@ func (db *DB) GetSubscriptionByID(id int) (*models.Subscription, error) {
 }
 
 func (db *DB) CreateSubscription(req models.CreateSubscriptionRequest, userID int) (*models.Subscription, error) {
-	query := `INSERT INTO subscriptions (name, category, price, billing_cycle, next_billing_date, user_id)
-	          VALUES ($1, $2, $3, $4, $5, $6) 
-	          RETURNING id, name, category, price, billing_cycle, next_billing_date, is_active, created_at, updated_at`
+	sub, err := createSubscription(db, req, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Invalidate cache after creation
+	if db.cacheService != nil {
+		db.cacheService.InvalidateUserSubscriptionsAndStatsCache(userID)
+	}
+
+	return sub, nil
+}
+
+// UpdateSubscription replaces a subscription of the user. A non-zero version
+// must match the stored one, otherwise models.ErrVersionConflict is returned.
+func (db *DB) UpdateSubscription(id int, userID int, version int, req models.CreateSubscriptionRequest) (*models.Subscription, error) {
+	sub, err := updateSubscription(db, id, userID, version, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Invalidate cache after update
+	if db.cacheService != nil {
+		db.cacheService.InvalidateUserSubscriptionsAndStatsCache(sub.UserID)
+	}
+
+	return sub, nil
+}
+
+// PatchSubscription updates only the columns set in patch. version is checked
+// like in UpdateSubscription.
+func (db *DB) PatchSubscription(id int, userID int, version int, patch models.SubscriptionPatch) (*models.Subscription, error) {
+	var sets []string
+	var args []interface{}
+	column := func(name string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", name, len(args)))
+	}
+
+	if patch.Name != nil {
+		column("name", *patch.Name)
+	}
+	if patch.Category != nil {
+		column("category", *patch.Category)
+	}
+	if patch.Price != nil {
+		column("price", *patch.Price)
+	}
+	if patch.BillingCycle != nil {
+		column("billing_cycle", *patch.BillingCycle)
+	}
+	if patch.NextBillingDate != nil {
+		column("next_billing_date", *patch.NextBillingDate)
+	}
+	if patch.IsActive != nil {
+		column("is_active", *patch.IsActive)
+	}
+	if len(sets) == 0 {
+		sub, err := db.GetSubscriptionByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if sub.UserID != userID {
+			return nil, sql.ErrNoRows
+		}
+		if version != 0 && sub.Version != version {
+			return nil, models.ErrVersionConflict
+		}
+		return sub, nil
+	}
+
+	args = append(args, id, userID, version)
+	query := fmt.Sprintf(`UPDATE subscriptions
+			  SET %s, updated_at = CURRENT_TIMESTAMP, version = version + 1
+			  WHERE id = $%d AND user_id = $%d AND ($%d::int = 0 OR version = $%d::int)
+			  RETURNING id, name, category, price, billing_cycle, next_billing_date, is_active, user_id, created_at, updated_at, version`,
+		strings.Join(sets, ", "), len(args)-2, len(args)-1, len(args), len(args))
 
 	var sub models.Subscription
-	err := db.QueryRow(
-		query,
-		req.Name,
-		req.Category,
-		req.Price,
-		req.BillingCycle,
-		req.NextBillingDate,
-		userID,
-	).Scan(
+	err := db.QueryRow(query, args...).Scan(
 		&sub.ID,
 		&sub.Name,
 		&sub.Category,
@@ -202,69 +555,77 @@ func (db *DB) CreateSubscription(req models.CreateSubscriptionRequest, userID in
 		&sub.BillingCycle,
 		&sub.NextBillingDate,
 		&sub.IsActive,
+		&sub.UserID,
 		&sub.CreatedAt,
 		&sub.UpdatedAt,
+		&sub.Version,
 	)
 	if err != nil {
-		return nil, err
+		return nil, versionConflict(db, id, userID, version, err)
 	}
 
-	// Invalidate cache after creation
+	// Invalidate cache after update
 	if db.cacheService != nil {
-		db.cacheService.InvalidateUserSubscriptionsAndStatsCache(userID)
+		db.cacheService.InvalidateUserSubscriptionsAndStatsCache(sub.UserID)
 	}
 
 	return &sub, nil
 }
 
-func (db *DB) UpdateSubscription(id int, req models.CreateSubscriptionRequest) (*models.Subscription, error) {
-	query := `UPDATE subscriptions 
-			  SET 
-			  	name = $1, 
-				category = $2,
-				price = $3, 
-				billing_cycle = $4, 
-				next_billing_date = $5, 
-				updated_at = CURRENT_TIMESTAMP 
-	          WHERE id = $6 
-			  RETURNING id, name, category, price, billing_cycle, next_billing_date, is_active, user_id, created_at, updated_at`
+// ImportSubscriptions creates or updates all items in a single transaction and
+// invalidates the user's cache once at the end
+func (db *DB) ImportSubscriptions(userID int, items []models.SubscriptionImport) ([]models.Subscription, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
-	var sub models.Subscription
-	err := db.QueryRow(query, req.Name, req.Category, req.Price, req.BillingCycle, req.NextBillingDate, id).
-		Scan(
-			&sub.ID,
-			&sub.Name,
-			&sub.Category,
-			&sub.Price,
-			&sub.BillingCycle,
-			&sub.NextBillingDate,
-			&sub.IsActive,
-			&sub.UserID,
-			&sub.CreatedAt,
-			&sub.UpdatedAt,
-		)
+	subscriptions := make([]models.Subscription, 0, len(items))
+	for _, item := range items {
+		var sub *models.Subscription
+		if item.ID != 0 {
+			sub, err = updateSubscription(tx, item.ID, userID, item.Version, item.Request)
+		} else {
+			sub, err = createSubscription(tx, item.Request, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if item.IsActive != nil && *item.IsActive != sub.IsActive {
+			if err := setSubscriptionActive(tx, sub, *item.IsActive); err != nil {
+				return nil, err
+			}
+		}
+
+		subscriptions = append(subscriptions, *sub)
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
 
-	// Invalidate cache after update
 	if db.cacheService != nil {
-		db.cacheService.InvalidateUserSubscriptionsAndStatsCache(sub.UserID)
+		db.cacheService.InvalidateUserSubscriptionsAndStatsCache(userID)
 	}
 
-	return &sub, nil
+	return subscriptions, nil
 }
 
-func (db *DB) DeleteSubscription(id int, userID int) error {
-	query := `DELETE FROM subscriptions WHERE id = $1`
-	_, err := db.Exec(query, id)
+// DeleteSubscription deletes a subscription of the user. version is checked
+// like in UpdateSubscription.
+func (db *DB) DeleteSubscription(id int, userID int, version int) error {
+	if err := deleteSubscription(db, id, userID, version); err != nil {
+		return err
+	}
 
 	// Invalidate cache after delete
 	if db.cacheService != nil {
 		db.cacheService.InvalidateUserSubscriptionsAndStatsCache(userID)
 	}
 
-	return err
+	return nil
 }
 
 func (db *DB) GetUpcomingSubscriptions() ([]models.Subscription, error) {
@@ -279,12 +640,14 @@ func (db *DB) GetUpcomingSubscriptions() ([]models.Subscription, error) {
 			s.is_active, 
 			s.created_at, 
 			s.updated_at,
+			s.version,
 			u.email
 		FROM subscriptions s
 		LEFT JOIN users u
 		ON s.user_id = u.id
 		WHERE s.next_billing_date <= CURRENT_DATE + INTERVAL '3 days'
 		AND s.is_active = true
+		AND u.email_verified_at IS NOT NULL
 	`
 
 	rows, err := db.Query(query)
@@ -306,6 +669,7 @@ func (db *DB) GetUpcomingSubscriptions() ([]models.Subscription, error) {
 			&sub.IsActive,
 			&sub.CreatedAt,
 			&sub.UpdatedAt,
+			&sub.Version,
 			&sub.Email,
 		)
 		if err != nil {
@@ -350,9 +714,9 @@ func (db *DB) GetUserSubscriptionsStats(userID int) (*models.SubscriptionStats,
 
 func (db *DB) CreateUser(user models.User) (*models.User, error) {
 	query := `
-		INSERT INTO users (email, password_hash, name, third_party)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, email, name, third_party, created_at, updated_at
+		INSERT INTO users (email, password_hash, name, third_party, email_verified_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $5 THEN CURRENT_TIMESTAMP END)
+		RETURNING id, email, name, third_party, created_at, updated_at, email_verified_at IS NOT NULL
 	`
 
 	var currentUser models.User
@@ -362,6 +726,7 @@ func (db *DB) CreateUser(user models.User) (*models.User, error) {
 		user.PasswordHash,
 		user.Name,
 		user.ThirdParty,
+		user.EmailVerified,
 	).Scan(
 		&currentUser.ID,
 		&currentUser.Email,
@@ -369,6 +734,7 @@ func (db *DB) CreateUser(user models.User) (*models.User, error) {
 		&currentUser.ThirdParty,
 		&currentUser.UpdatedAt,
 		&currentUser.CreatedAt,
+		&currentUser.EmailVerified,
 	)
 	if err != nil {
 		return nil, err
@@ -384,7 +750,8 @@ func (db *DB) GetUserByID(id int) (*models.User, error) {
 			name,
 			email,
 			updated_at,
-			created_at
+			created_at,
+			email_verified_at IS NOT NULL
 		FROM users
 		WHERE
 			id = $1
@@ -398,6 +765,7 @@ func (db *DB) GetUserByID(id int) (*models.User, error) {
 		&user.Email,
 		&user.UpdatedAt,
 		&user.CreatedAt,
+		&user.EmailVerified,
 	)
 	if err != nil {
 		return nil, err
@@ -415,7 +783,8 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 			email, 
 			third_party, 
 			created_at, 
-			updated_at
+			updated_at,
+			email_verified_at IS NOT NULL
 		FROM users
 		WHERE
 			email = $1
@@ -432,6 +801,7 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 		&user.ThirdParty,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.EmailVerified,
 	)
 
 	fmt.Println(err)
@@ -442,3 +812,1853 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 
 	return &user, nil
 }
+
+// VerifyUserEmail marks the user's email as verified. It gives sql.ErrNoRows
+// when the user no longer has that email.
+func (db *DB) VerifyUserEmail(userID int, email string) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND email = $2
+	`
+
+	result, err := db.Exec(query, userID, email)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UpdateUserName renames the user and returns the updated user
+func (db *DB) UpdateUserName(id int, name string) (*models.User, error) {
+	query := `
+		UPDATE users
+		SET name = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING id, name, email, updated_at, created_at, email_verified_at IS NOT NULL
+	`
+
+	var user models.User
+	err := db.QueryRow(query, id, name).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.UpdatedAt,
+		&user.CreatedAt,
+		&user.EmailVerified,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ChangeUserPassword sets a new password and ends every session of the user
+// except keepSessionID. Pending password reset links stop working too.
+func (db *DB) ChangeUserPassword(id int, passwordHash string, keepSessionID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET password_hash = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	result, err := tx.Exec(query, id, passwordHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	query = `UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.Exec(query, id); err != nil {
+		return err
+	}
+
+	query = `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+	if _, err := tx.Exec(query, id, keepSessionID); err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL
+			AND family_id NOT IN (SELECT family_id FROM sessions WHERE id = $2)
+	`
+	if _, err := tx.Exec(query, id, keepSessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ChangeUserEmail moves the user from currentEmail to newEmail and marks it
+// verified. It gives models.ErrEmailTaken when another user has newEmail and
+// sql.ErrNoRows when the user's email is no longer currentEmail.
+func (db *DB) ChangeUserEmail(id int, currentEmail string, newEmail string) (*models.User, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// users.email has no unique index, so concurrent changes to the same
+	// address are serialized to keep GetUserByEmail unambiguous
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('users.email:' || $1))`, newEmail); err != nil {
+		return nil, err
+	}
+
+	var taken bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id <> $2)`
+	if err := tx.QueryRow(query, newEmail, id).Scan(&taken); err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, models.ErrEmailTaken
+	}
+
+	query = `
+		UPDATE users
+		SET email = $3, email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND email = $2
+		RETURNING id, name, email, updated_at, created_at, email_verified_at IS NOT NULL
+	`
+
+	var user models.User
+	err = tx.QueryRow(query, id, currentEmail, newEmail).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.UpdatedAt,
+		&user.CreatedAt,
+		&user.EmailVerified,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Cached subscriptions carry the owner's email
+	if db.cacheService != nil {
+		db.cacheService.InvalidateUserSubscriptionsCache(id)
+	}
+
+	return &user, nil
+}
+
+// DeleteUser removes a user. Subscriptions and calendar feeds are removed by
+// their ON DELETE CASCADE foreign keys.
+func (db *DB) DeleteUser(id int) error {
+	query := `DELETE FROM users WHERE id = $1`
+	result, err := db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	// Purge cached data and idempotency keys after delete
+	if db.cacheService != nil {
+		if err := db.cacheService.PurgeUser(id); err != nil {
+			log.Printf("Failed to purge Redis keys of deleted user %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// Calendar feed methods
+
+func (db *DB) SetCalendarFeedToken(userID int, tokenHash string) error {
+	query := `
+		INSERT INTO calendar_feeds (user_id, token_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, created_at = CURRENT_TIMESTAMP
+	`
+
+	_, err := db.Exec(query, userID, tokenHash)
+	return err
+}
+
+func (db *DB) DeleteCalendarFeedToken(userID int) error {
+	query := `DELETE FROM calendar_feeds WHERE user_id = $1`
+	_, err := db.Exec(query, userID)
+	return err
+}
+
+// GetCalendarFeed reports whether the user has a calendar feed and when its
+// URL was issued
+func (db *DB) GetCalendarFeed(userID int) (*models.CalendarFeed, error) {
+	query := `SELECT created_at FROM calendar_feeds WHERE user_id = $1`
+
+	var createdAt time.Time
+	err := db.QueryRow(query, userID).Scan(&createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.CalendarFeed{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CalendarFeed{Enabled: true, CreatedAt: &createdAt}, nil
+}
+
+func (db *DB) GetUserByCalendarFeedToken(tokenHash string) (*models.User, error) {
+	query := `
+		SELECT
+			u.id,
+			u.name,
+			u.email,
+			u.updated_at,
+			u.created_at
+		FROM calendar_feeds f
+		JOIN users u
+		ON f.user_id = u.id
+		WHERE
+			f.token_hash = $1
+	`
+
+	row := db.QueryRow(query, tokenHash)
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.UpdatedAt,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Catalog methods
+
+// SeedCatalogServices inserts bundled services that are not in the table yet.
+// Services edited or removed by an admin are left untouched, except that
+// bundle contents are filled in for rows seeded before they existed.
+func (db *DB) SeedCatalogServices(services []models.CatalogService) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO catalog_services (id, name, aliases, category, logo_key, includes, plans)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE
+		SET includes = EXCLUDED.includes
+		WHERE catalog_services.includes = '[]'
+	`
+
+	for _, service := range services {
+		aliases, includes, plans, err := marshalCatalogService(service)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(query, service.ID, service.Name, aliases, service.Category, service.LogoKey, includes, plans)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) GetCatalogServices() ([]models.CatalogService, error) {
+	query := `
+		SELECT
+			id,
+			name,
+			aliases,
+			category,
+			COALESCE(logo_key, ''),
+			includes,
+			plans
+		FROM catalog_services
+		WHERE is_active = true
+		ORDER BY name
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	services := []models.CatalogService{}
+	for rows.Next() {
+		var service models.CatalogService
+		var aliases, includes, plans []byte
+		err := rows.Scan(
+			&service.ID,
+			&service.Name,
+			&aliases,
+			&service.Category,
+			&service.LogoKey,
+			&includes,
+			&plans,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(aliases, &service.Aliases); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(includes, &service.Includes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(plans, &service.Plans); err != nil {
+			return nil, err
+		}
+
+		services = append(services, service)
+	}
+
+	return services, rows.Err()
+}
+
+func (db *DB) UpsertCatalogService(service models.CatalogService) error {
+	aliases, includes, plans, err := marshalCatalogService(service)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO catalog_services (id, name, aliases, category, logo_key, includes, plans)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE
+		SET
+			name = EXCLUDED.name,
+			aliases = EXCLUDED.aliases,
+			category = EXCLUDED.category,
+			logo_key = EXCLUDED.logo_key,
+			includes = EXCLUDED.includes,
+			plans = EXCLUDED.plans,
+			is_active = true,
+			updated_at = CURRENT_TIMESTAMP
+	`
+
+	_, err = db.Exec(query, service.ID, service.Name, aliases, service.Category, service.LogoKey, includes, plans)
+	return err
+}
+
+// DeleteCatalogService hides a service instead of deleting the row, so that
+// seeding the bundled catalog on the next start doesn't bring it back
+func (db *DB) DeleteCatalogService(id string) error {
+	query := `UPDATE catalog_services SET is_active = false, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND is_active = true`
+	result, err := db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func marshalCatalogService(service models.CatalogService) ([]byte, []byte, []byte, error) {
+	if service.Aliases == nil {
+		service.Aliases = []string{}
+	}
+	if service.Includes == nil {
+		service.Includes = []string{}
+	}
+	if service.Plans == nil {
+		service.Plans = []models.CatalogPlan{}
+	}
+
+	aliases, err := json.Marshal(service.Aliases)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	includes, err := json.Marshal(service.Includes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plans, err := json.Marshal(service.Plans)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return aliases, includes, plans, nil
+}
+
+// Webhook methods
+
+func (db *DB) CreateWebhook(webhook models.Webhook) (*models.Webhook, error) {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, events, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+
+	err = db.QueryRow(query, webhook.UserID, webhook.URL, webhook.Secret, events, webhook.IsActive).Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (db *DB) GetUserWebhooks(userID int) ([]models.Webhook, error) {
+	query := `
+		SELECT id, user_id, url, secret, events, is_active, created_at, updated_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// GetWebhook returns sql.ErrNoRows if the webhook does not belong to userID
+func (db *DB) GetWebhook(id int, userID int) (*models.Webhook, error) {
+	query := `
+		SELECT id, user_id, url, secret, events, is_active, created_at, updated_at
+		FROM webhooks
+		WHERE id = $1 AND user_id = $2
+	`
+
+	return scanWebhook(db.QueryRow(query, id, userID))
+}
+
+func (db *DB) UpdateWebhook(webhook models.Webhook) (*models.Webhook, error) {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, is_active = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND user_id = $5
+		RETURNING id, user_id, url, secret, events, is_active, created_at, updated_at
+	`
+
+	return scanWebhook(db.QueryRow(query, webhook.URL, events, webhook.IsActive, webhook.ID, webhook.UserID))
+}
+
+func (db *DB) DeleteWebhook(id int, userID int) error {
+	result, err := db.Exec(`DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetWebhooksForEvent returns the user's active webhooks subscribed to event
+func (db *DB) GetWebhooksForEvent(userID int, event string) ([]models.Webhook, error) {
+	eventJSON, err := json.Marshal([]string{event})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, user_id, url, secret, events, is_active, created_at, updated_at
+		FROM webhooks
+		WHERE user_id = $1 AND is_active = true AND events @> $2
+	`
+
+	rows, err := db.Query(query, userID, eventJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (db *DB) CreateWebhookDelivery(delivery models.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+	`
+
+	_, err := db.Exec(query, delivery.WebhookID, delivery.EventID, delivery.Event, string(delivery.Payload), models.DeliveryPending)
+	return err
+}
+
+// ClaimDueWebhookDeliveries picks up to limit pending deliveries whose next
+// attempt is due and pushes their next attempt back by lease, so that other
+// instances polling at the same time skip them while they are being sent
+func (db *DB) ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM webhooks w
+		WHERE d.webhook_id = w.id
+			AND d.id IN (
+				SELECT id
+				FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+		RETURNING d.id, d.webhook_id, d.event_id, d.event, d.payload, d.status, d.attempts,
+			d.response_status, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at,
+			w.url, w.secret
+	`
+
+	rows, err := db.Query(query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (db *DB) RecordWebhookAttempt(id int, attempt models.WebhookAttempt) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1,
+			attempts = attempts + 1,
+			response_status = $2,
+			last_error = NULLIF($3, ''),
+			next_attempt_at = CASE WHEN $4::float8 > 0 THEN CURRENT_TIMESTAMP + make_interval(secs => $4::float8) END,
+			delivered_at = CASE WHEN $1 = 'succeeded' THEN CURRENT_TIMESTAMP ELSE delivered_at END
+		WHERE id = $5
+	`
+
+	_, err := db.Exec(query, attempt.Status, attempt.ResponseStatus, attempt.Error, attempt.RetryIn.Seconds(), id)
+	return err
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a webhook owned by userID
+func (db *DB) GetWebhookDeliveries(webhookID int, userID int, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT d.id, d.webhook_id, d.event_id, d.event, d.payload, d.status, d.attempts,
+			d.response_status, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN webhooks w
+		ON d.webhook_id = w.id
+		WHERE d.webhook_id = $1 AND w.user_id = $2
+		ORDER BY d.id DESC
+		LIMIT $3
+	`
+
+	rows, err := db.Query(query, webhookID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetUserWebhookDeliveries returns the delivery logs of all of the user's
+// webhooks, newest first
+func (db *DB) GetUserWebhookDeliveries(userID int) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT d.id, d.webhook_id, d.event_id, d.event, d.payload, d.status, d.attempts,
+			d.response_status, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN webhooks w
+		ON d.webhook_id = w.id
+		WHERE w.user_id = $1
+		ORDER BY d.id DESC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ReplayWebhookDelivery queues a finished delivery to be sent again with a
+// fresh set of retries. It returns sql.ErrNoRows if the delivery does not
+// exist, is still pending or belongs to another user.
+func (db *DB) ReplayWebhookDelivery(id int, webhookID int, userID int) (*models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET status = 'pending',
+			attempts = 0,
+			last_error = NULL,
+			response_status = NULL,
+			next_attempt_at = CURRENT_TIMESTAMP
+		FROM webhooks w
+		WHERE d.webhook_id = w.id
+			AND d.id = $1 AND d.webhook_id = $2 AND w.user_id = $3
+			AND d.status <> 'pending'
+		RETURNING d.id, d.webhook_id, d.event_id, d.event, d.payload, d.status, d.attempts,
+			d.response_status, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at
+	`
+
+	return scanWebhookDelivery(db.QueryRow(query, id, webhookID, userID), false)
+}
+
+// DeleteWebhookDeliveriesOlderThan prunes finished deliveries older than age
+func (db *DB) DeleteWebhookDeliveriesOlderThan(age time.Duration) (int64, error) {
+	query := `
+		DELETE FROM webhook_deliveries
+		WHERE status <> 'pending' AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+	`
+
+	result, err := db.Exec(query, age.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetSubscriptionsWithWebhooks returns the active subscriptions of users who
+// have at least one active webhook
+func (db *DB) GetSubscriptionsWithWebhooks() ([]models.Subscription, error) {
+	query := `
+		SELECT
+			s.id,
+			s.name,
+			s.category,
+			s.price,
+			s.billing_cycle,
+			s.next_billing_date,
+			s.is_active,
+			s.user_id,
+			s.created_at,
+			s.updated_at,
+			s.version
+		FROM subscriptions s
+		WHERE s.is_active = true
+			AND EXISTS (SELECT 1 FROM webhooks w WHERE w.user_id = s.user_id AND w.is_active = true)
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []models.Subscription
+	for rows.Next() {
+		var sub models.Subscription
+		err := rows.Scan(
+			&sub.ID,
+			&sub.Name,
+			&sub.Category,
+			&sub.Price,
+			&sub.BillingCycle,
+			&sub.NextBillingDate,
+			&sub.IsActive,
+			&sub.UserID,
+			&sub.CreatedAt,
+			&sub.UpdatedAt,
+			&sub.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// ReserveIdempotencyKey stores a pending record for the key unless an
+// unexpired one already exists. It reports whether the key was reserved.
+// Expired rows are only overwritten here when their key is reused; the rest
+// are pruned by DeleteExpiredIdempotencyKeys.
+func (db *DB) ReserveIdempotencyKey(record models.IdempotencyRecord, lease time.Duration) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, completed, expires_at)
+		VALUES ($1, $2, $3, false, CURRENT_TIMESTAMP + make_interval(secs => $4))
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, completed = false, status_code = NULL,
+			header = NULL, body = NULL, created_at = CURRENT_TIMESTAMP, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+	`
+
+	result, err := db.Exec(query, record.UserID, record.Key, record.Fingerprint, lease.Seconds())
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (db *DB) GetIdempotencyKey(userID int, key string) (*models.IdempotencyRecord, error) {
+	query := `
+		SELECT user_id, key, fingerprint, completed, status_code, header, body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND expires_at > CURRENT_TIMESTAMP
+	`
+
+	var record models.IdempotencyRecord
+	var statusCode sql.NullInt64
+	var header []byte
+	err := db.QueryRow(query, userID, key).Scan(
+		&record.UserID, &record.Key, &record.Fingerprint, &record.Completed, &statusCode, &header, &record.Body,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	record.StatusCode = int(statusCode.Int64)
+	if len(header) > 0 {
+		if err := json.Unmarshal(header, &record.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request holding the key
+// and keeps it for ttl
+func (db *DB) CompleteIdempotencyKey(record models.IdempotencyRecord, ttl time.Duration) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET completed = true, status_code = $3, header = $4, body = $5,
+			expires_at = CURRENT_TIMESTAMP + make_interval(secs => $6)
+		WHERE user_id = $1 AND key = $2
+	`
+
+	_, err = db.Exec(query, record.UserID, record.Key, record.StatusCode, string(header), record.Body, ttl.Seconds())
+	return err
+}
+
+func (db *DB) DeleteIdempotencyKey(userID int, key string) error {
+	_, err := db.Exec(`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes records past their expiry together
+// with their stored responses. The scheduler runs it daily.
+func (db *DB) DeleteExpiredIdempotencyKeys() (int64, error) {
+	result, err := db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RotateRefreshToken marks the token as rotated and stores next, valid for
+// ttl, in its family. A token that was rotated more than reuseGrace ago has
+// been replayed, so its family is revoked and ErrRefreshTokenReused returned.
+// Revoked, expired and unknown tokens give sql.ErrNoRows.
+func (db *DB) RotateRefreshToken(tokenHash string, next models.RefreshToken, ttl, reuseGrace time.Duration) (*models.RefreshToken, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, user_id, family_id, rotated_at < CURRENT_TIMESTAMP - make_interval(secs => $2)
+		FROM refresh_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		FOR UPDATE
+	`
+
+	var id int
+	var reused sql.NullBool
+	err = tx.QueryRow(query, tokenHash, reuseGrace.Seconds()).Scan(&id, &next.UserID, &next.FamilyID, &reused)
+	if err != nil {
+		return nil, err
+	}
+
+	if reused.Bool {
+		if err := revokeRefreshTokenFamily(tx, next.FamilyID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrRefreshTokenReused
+	}
+
+	// A token replayed within the grace period keeps its first rotation time,
+	// so concurrent refreshes from several tabs all succeed
+	_, err = tx.Exec(`UPDATE refresh_tokens SET rotated_at = COALESCE(rotated_at, CURRENT_TIMESTAMP) WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := createRefreshToken(tx, next, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, tx.Commit()
+}
+
+// RevokeRefreshTokenFamily ends the session the token belongs to, revoking
+// every token rotated from the same sign-in. Unknown tokens are ignored.
+func (db *DB) RevokeRefreshTokenFamily(tokenHash string) error {
+	var familyID string
+	err := db.QueryRow(`SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, tokenHash).Scan(&familyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return revokeRefreshTokenFamily(db, familyID)
+}
+
+// DeleteExpiredRefreshTokens removes tokens past their expiry, and sessions
+// left without tokens. Rotated tokens are kept until then so that replaying
+// them is still detected.
+func (db *DB) DeleteExpiredRefreshTokens() (int64, error) {
+	result, err := db.Exec(`DELETE FROM refresh_tokens WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		DELETE FROM sessions s
+		WHERE NOT EXISTS (SELECT 1 FROM refresh_tokens t WHERE t.family_id = s.family_id)
+	`
+	if _, err := db.Exec(query); err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// CreateSession stores a session and the first refresh token of its family,
+// valid for ttl
+func (db *DB) CreateSession(session models.Session, tokenHash string, ttl time.Duration) (*models.Session, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sessions (user_id, family_id, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + sessionColumns
+
+	created, err := scanSession(tx.QueryRow(query, session.UserID, session.FamilyID, session.UserAgent, session.IPAddress))
+	if err != nil {
+		return nil, err
+	}
+
+	token := models.RefreshToken{UserID: session.UserID, FamilyID: session.FamilyID, TokenHash: tokenHash}
+	if _, err := createRefreshToken(tx, token, ttl); err != nil {
+		return nil, err
+	}
+
+	return created, tx.Commit()
+}
+
+// TouchSession records that the session's token family was just used from
+// the given client. Revoked sessions give sql.ErrNoRows.
+func (db *DB) TouchSession(familyID string, userAgent string, ipAddress string) (*models.Session, error) {
+	query := `
+		UPDATE sessions
+		SET last_seen_at = CURRENT_TIMESTAMP, user_agent = $2, ip_address = $3
+		WHERE family_id = $1 AND revoked_at IS NULL
+		RETURNING ` + sessionColumns
+
+	return scanSession(db.QueryRow(query, familyID, userAgent, ipAddress))
+}
+
+// GetSession returns one of the user's sessions, including revoked ones
+func (db *DB) GetSession(id int, userID int) (*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1 AND user_id = $2`
+	return scanSession(db.QueryRow(query, id, userID))
+}
+
+// GetUserSessions lists the user's sessions that can still be refreshed, most
+// recently used first
+func (db *DB) GetUserSessions(userID int) ([]models.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL
+			AND EXISTS (
+				SELECT 1 FROM refresh_tokens t
+				WHERE t.family_id = sessions.family_id AND t.revoked_at IS NULL AND t.expires_at > CURRENT_TIMESTAMP
+			)
+		ORDER BY last_seen_at DESC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession ends one of the user's sessions. Unknown and already revoked
+// sessions give sql.ErrNoRows.
+func (db *DB) RevokeSession(id int, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var familyID string
+	query := `SELECT family_id FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	if err := tx.QueryRow(query, id, userID).Scan(&familyID); err != nil {
+		return err
+	}
+
+	if err := revokeRefreshTokenFamily(tx, familyID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeOtherSessions ends every active session of the user except keepID
+// and returns how many were ended. A keepID of 0 ends all of them.
+func (db *DB) RevokeOtherSessions(userID int, keepID int) (int64, error) {
+	query := `
+		WITH revoked AS (
+			UPDATE sessions
+			SET revoked_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+			RETURNING family_id
+		), revoked_tokens AS (
+			UPDATE refresh_tokens
+			SET revoked_at = CURRENT_TIMESTAMP
+			WHERE family_id IN (SELECT family_id FROM revoked) AND revoked_at IS NULL
+			RETURNING family_id, expires_at
+		)
+		SELECT COUNT(DISTINCT family_id) FROM revoked_tokens WHERE expires_at > CURRENT_TIMESTAMP
+	`
+
+	var revoked int64
+	err := db.QueryRow(query, userID, keepID).Scan(&revoked)
+	return revoked, err
+}
+
+// CreatePasswordResetToken stores a reset token for the user that expires
+// after ttl
+func (db *DB) CreatePasswordResetToken(userID int, tokenHash string, ttl time.Duration) error {
+	query := `
+		INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))
+	`
+
+	_, err := db.Exec(query, tokenHash, userID, ttl.Seconds())
+	return err
+}
+
+// ResetPassword uses up the reset token and sets the password of its user.
+// Every other reset token of the user is used up too, and all their sessions
+// are ended. Used, expired and unknown tokens give sql.ErrNoRows.
+func (db *DB) ResetPassword(tokenHash string, passwordHash string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id
+	`
+	if err := tx.QueryRow(query, tokenHash).Scan(&userID); err != nil {
+		return 0, err
+	}
+
+	query = `UPDATE users SET password_hash = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	if _, err := tx.Exec(query, userID, passwordHash); err != nil {
+		return 0, err
+	}
+
+	revocations := []string{
+		`UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL`,
+		`UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`,
+		`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`,
+	}
+	for _, query := range revocations {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	return userID, tx.Commit()
+}
+
+// DeleteExpiredPasswordResetTokens removes reset tokens that can no longer
+// be used
+func (db *DB) DeleteExpiredPasswordResetTokens() (int64, error) {
+	result, err := db.Exec(`DELETE FROM password_reset_tokens WHERE expires_at <= CURRENT_TIMESTAMP OR used_at IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Two-factor authentication methods
+
+// GetTOTP returns the authenticator secret of the user with the number of
+// unused recovery codes. It gives sql.ErrNoRows when the user has none.
+func (db *DB) GetTOTP(userID int) (*models.TOTP, error) {
+	query := `
+		SELECT
+			t.user_id,
+			t.secret,
+			t.last_used_step,
+			t.enabled_at,
+			(SELECT COUNT(*) FROM recovery_codes rc WHERE rc.user_id = t.user_id AND rc.used_at IS NULL)
+		FROM user_totp t
+		WHERE t.user_id = $1
+	`
+
+	var totp models.TOTP
+	err := db.QueryRow(query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.LastUsedStep,
+		&totp.EnabledAt,
+		&totp.RecoveryCodesLeft,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+// SaveTOTPSecret stores a new secret awaiting confirmation. It replaces an
+// unconfirmed secret but never an enabled one, which gives sql.ErrNoRows.
+func (db *DB) SaveTOTPSecret(userID int, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.enabled_at IS NULL
+	`
+
+	result, err := db.Exec(query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// EnableTOTP turns on the user's unconfirmed secret once a code from step was
+// accepted, and replaces their recovery codes. It gives sql.ErrNoRows when
+// there is no unconfirmed secret.
+func (db *DB) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE user_totp
+		SET enabled_at = CURRENT_TIMESTAMP, last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`
+	result, err := tx.Exec(query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code from step was accepted. It gives
+// sql.ErrNoRows when a code from that step or a later one was already used.
+func (db *DB) UseTOTPStep(userID int, step int64) error {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2
+	`
+
+	result, err := db.Exec(query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes. Used and unknown
+// codes give sql.ErrNoRows.
+func (db *DB) UseRecoveryCode(userID int, codeHash string) error {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := db.Exec(query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes swaps every recovery code of the user, used or not,
+// for a new set
+func (db *DB) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP removes the user's authenticator secret and recovery codes
+func (db *DB) DisableTOTP(userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Passkey methods
+
+// SetWebAuthnID gives the user a WebAuthn user handle unless they have one
+// and returns the handle they end up with
+func (db *DB) SetWebAuthnID(userID int, handle []byte) ([]byte, error) {
+	query := `
+		UPDATE users
+		SET webauthn_id = COALESCE(webauthn_id, $2)
+		WHERE id = $1
+		RETURNING webauthn_id
+	`
+
+	var current []byte
+	err := db.QueryRow(query, userID, handle).Scan(&current)
+	return current, err
+}
+
+func (db *DB) GetUserByWebAuthnID(handle []byte) (*models.User, error) {
+	query := `
+		SELECT
+			id,
+			name,
+			email,
+			third_party,
+			created_at,
+			updated_at,
+			email_verified_at IS NOT NULL
+		FROM users
+		WHERE webauthn_id = $1
+	`
+
+	var user models.User
+	err := db.QueryRow(query, handle).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.ThirdParty,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.EmailVerified,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CreatePasskey stores a new passkey. It gives sql.ErrNoRows when the
+// credential is already registered.
+func (db *DB) CreatePasskey(passkey models.Passkey) (*models.Passkey, error) {
+	query := `
+		INSERT INTO passkeys (user_id, credential_id, name, credential, sign_count)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (credential_id) DO NOTHING
+		RETURNING ` + passkeyColumns
+
+	return scanPasskey(db.QueryRow(query, passkey.UserID, passkey.CredentialID, passkey.Name, []byte(passkey.Credential), passkey.SignCount))
+}
+
+func (db *DB) GetUserPasskeys(userID int) ([]models.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []models.Passkey{}
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, *passkey)
+	}
+
+	return passkeys, rows.Err()
+}
+
+func (db *DB) GetPasskeyByCredentialID(credentialID []byte) (*models.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE credential_id = $1`
+	return scanPasskey(db.QueryRow(query, credentialID))
+}
+
+// UpdatePasskeyUsage stores the credential record after a sign-in. The
+// signature counter has to grow unless the authenticator doesn't keep one,
+// so it gives sql.ErrNoRows when another sign-in already used the count.
+func (db *DB) UpdatePasskeyUsage(id int, signCount uint32, credential []byte) error {
+	query := `
+		UPDATE passkeys
+		SET sign_count = $2, credential = $3, last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0))
+	`
+
+	result, err := db.Exec(query, id, signCount, credential)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *DB) DeletePasskey(id int, userID int) error {
+	result, err := db.Exec(`DELETE FROM passkeys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CreateWebAuthnCeremony stores the server side of a ceremony for ttl
+func (db *DB) CreateWebAuthnCeremony(ceremony models.WebAuthnCeremony, ttl time.Duration) error {
+	query := `
+		INSERT INTO webauthn_ceremonies (id_hash, user_id, kind, session, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))
+	`
+
+	_, err := db.Exec(query, ceremony.IDHash, ceremony.UserID, ceremony.Kind, []byte(ceremony.Session), ttl.Seconds())
+	return err
+}
+
+// ConsumeWebAuthnCeremony removes and returns a ceremony, so each one can be
+// finished once. Expired and unknown ceremonies give sql.ErrNoRows.
+func (db *DB) ConsumeWebAuthnCeremony(idHash string, kind string) (*models.WebAuthnCeremony, error) {
+	query := `
+		DELETE FROM webauthn_ceremonies
+		WHERE id_hash = $1 AND kind = $2
+		RETURNING id_hash, COALESCE(user_id, 0), kind, session, expires_at > CURRENT_TIMESTAMP
+	`
+
+	var ceremony models.WebAuthnCeremony
+	var session []byte
+	var live bool
+	err := db.QueryRow(query, idHash, kind).Scan(&ceremony.IDHash, &ceremony.UserID, &ceremony.Kind, &session, &live)
+	if err != nil {
+		return nil, err
+	}
+	if !live {
+		return nil, sql.ErrNoRows
+	}
+
+	ceremony.Session = session
+	return &ceremony, nil
+}
+
+func (db *DB) DeleteExpiredWebAuthnCeremonies() (int64, error) {
+	result, err := db.Exec(`DELETE FROM webauthn_ceremonies WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events []byte
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		&webhook.Secret,
+		&events,
+		&webhook.IsActive,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(events, &webhook.Events); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func scanWebhookDelivery(row scanner, withTarget bool) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var payload string
+	var responseStatus sql.NullInt64
+	var lastError sql.NullString
+	var nextAttemptAt, deliveredAt sql.NullTime
+
+	dest := []interface{}{
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&responseStatus,
+		&lastError,
+		&nextAttemptAt,
+		&delivery.CreatedAt,
+		&deliveredAt,
+	}
+	if withTarget {
+		dest = append(dest, &delivery.URL, &delivery.Secret)
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = json.RawMessage(payload)
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		delivery.ResponseStatus = &status
+	}
+	delivery.LastError = lastError.String
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+
+	return &delivery, nil
+}
+
+// Batch methods
+
+// BatchSubscriptions applies create, update and delete operations for a user
+// in one transaction and invalidates the cache once. Each result's Err is nil
+// on success, sql.ErrNoRows for a missing subscription, ErrVersionConflict or
+// the error that stopped it. In atomic mode the first failing operation rolls
+// back the whole batch: the operations before it get ErrBatchRolledBack and
+// the ones after ErrBatchNotAttempted. Otherwise each operation runs in its
+// own savepoint so that failures only undo that operation.
+func (db *DB) BatchSubscriptions(userID int, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	results := make([]models.BatchResult, len(ops))
+	for i, op := range ops {
+		if !atomic {
+			if _, err := tx.Exec(`SAVEPOINT batch_op`); err != nil {
+				return nil, false, err
+			}
+		}
+
+		results[i] = applyBatchOperation(tx, userID, op)
+		results[i].Index = i
+
+		if results[i].Err == nil {
+			if !atomic {
+				if _, err := tx.Exec(`RELEASE SAVEPOINT batch_op`); err != nil {
+					return nil, false, err
+				}
+			}
+			continue
+		}
+
+		if atomic {
+			for j := 0; j < i; j++ {
+				results[j].Subscription = nil
+				results[j].Err = models.ErrBatchRolledBack
+			}
+			for j := i + 1; j < len(ops); j++ {
+				results[j] = models.BatchResult{
+					Index: j,
+					Op:    ops[j].Op,
+					ID:    ops[j].ID,
+					Err:   models.ErrBatchNotAttempted,
+				}
+			}
+			return results, false, nil
+		}
+
+		if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT batch_op`); err != nil {
+			return nil, false, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if db.cacheService != nil {
+		db.cacheService.InvalidateUserSubscriptionsAndStatsCache(userID)
+	}
+
+	return results, true, nil
+}
+
+func applyBatchOperation(q queryer, userID int, op models.BatchOperation) models.BatchResult {
+	result := models.BatchResult{Op: op.Op, ID: op.ID}
+
+	if op.Op != models.BatchCreate {
+		var ownerID int
+		err := q.QueryRow(`SELECT user_id FROM subscriptions WHERE id = $1`, op.ID).Scan(&ownerID)
+		if err == nil && ownerID != userID {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	switch op.Op {
+	case models.BatchCreate:
+		result.Subscription, result.Err = createSubscription(q, op.Subscription, userID)
+	case models.BatchUpdate:
+		result.Subscription, result.Err = updateSubscription(q, op.ID, userID, op.Version, op.Subscription)
+	case models.BatchDelete:
+		result.Err = deleteSubscription(q, op.ID, userID, op.Version)
+	}
+
+	if result.Err != nil {
+		result.Subscription = nil
+		return result
+	}
+	if result.Subscription != nil {
+		result.ID = result.Subscription.ID
+	}
+
+	return result
+}
+
+// Shared statements that run on either the connection pool or a transaction
+
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func createSubscription(q queryer, req models.CreateSubscriptionRequest, userID int) (*models.Subscription, error) {
+	query := `INSERT INTO subscriptions (name, category, price, billing_cycle, next_billing_date, user_id)
+	          VALUES ($1, $2, $3, $4, $5, $6) 
+	          RETURNING id, name, category, price, billing_cycle, next_billing_date, is_active, user_id, created_at, updated_at, version`
+
+	var sub models.Subscription
+	err := q.QueryRow(
+		query,
+		req.Name,
+		req.Category,
+		req.Price,
+		req.BillingCycle,
+		req.NextBillingDate,
+		userID,
+	).Scan(
+		&sub.ID,
+		&sub.Name,
+		&sub.Category,
+		&sub.Price,
+		&sub.BillingCycle,
+		&sub.NextBillingDate,
+		&sub.IsActive,
+		&sub.UserID,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+		&sub.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+func updateSubscription(q queryer, id int, userID int, version int, req models.CreateSubscriptionRequest) (*models.Subscription, error) {
+	query := `UPDATE subscriptions 
+			  SET 
+			  	name = $1, 
+				category = $2,
+				price = $3, 
+				billing_cycle = $4, 
+				next_billing_date = $5, 
+				updated_at = CURRENT_TIMESTAMP,
+				version = version + 1
+	          WHERE id = $6 AND user_id = $7 AND ($8::int = 0 OR version = $8::int)
+			  RETURNING id, name, category, price, billing_cycle, next_billing_date, is_active, user_id, created_at, updated_at, version`
+
+	var sub models.Subscription
+	err := q.QueryRow(query, req.Name, req.Category, req.Price, req.BillingCycle, req.NextBillingDate, id, userID, version).
+		Scan(
+			&sub.ID,
+			&sub.Name,
+			&sub.Category,
+			&sub.Price,
+			&sub.BillingCycle,
+			&sub.NextBillingDate,
+			&sub.IsActive,
+			&sub.UserID,
+			&sub.CreatedAt,
+			&sub.UpdatedAt,
+			&sub.Version,
+		)
+	if err != nil {
+		return nil, versionConflict(q, id, userID, version, err)
+	}
+
+	return &sub, nil
+}
+
+// setSubscriptionActive changes is_active of a subscription written earlier
+// in the same transaction, so it keeps the version of that write
+func setSubscriptionActive(q queryer, sub *models.Subscription, active bool) error {
+	_, err := q.Exec(`UPDATE subscriptions SET is_active = $1 WHERE id = $2`, active, sub.ID)
+	if err != nil {
+		return err
+	}
+
+	sub.IsActive = active
+	return nil
+}
+
+func deleteSubscription(q queryer, id int, userID int, version int) error {
+	query := `DELETE FROM subscriptions WHERE id = $1 AND user_id = $2 AND ($3::int = 0 OR version = $3::int)`
+	result, err := q.Exec(query, id, userID, version)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return versionConflict(q, id, userID, version, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// versionConflict tells apart the two reasons a versioned write matched no
+// row: the subscription is gone (err is kept) or its version has moved on
+func versionConflict(q queryer, id int, userID int, version int, err error) error {
+	if !errors.Is(err, sql.ErrNoRows) || version == 0 {
+		return err
+	}
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE id = $1 AND user_id = $2)`
+	if err := q.QueryRow(query, id, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return models.ErrVersionConflict
+	}
+
+	return sql.ErrNoRows
+}
+
+func createRefreshToken(q queryer, token models.RefreshToken, ttl time.Duration) (*models.RefreshToken, error) {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+	          VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))
+	          RETURNING id, expires_at, created_at`
+
+	err := q.QueryRow(query, token.UserID, token.FamilyID, token.TokenHash, ttl.Seconds()).Scan(&token.ID, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// revokeRefreshTokenFamily revokes every token of the family and ends the
+// session that owns it
+func revokeRefreshTokenFamily(q queryer, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL`
+	if _, err := q.Exec(query, familyID); err != nil {
+		return err
+	}
+
+	query = `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL`
+	_, err := q.Exec(query, familyID)
+	return err
+}
+
+const sessionColumns = `id, user_id, family_id, user_agent, ip_address, created_at, last_seen_at, revoked_at`
+
+const passkeyColumns = `id, user_id, credential_id, name, credential, sign_count, created_at, last_used_at`
+
+func scanPasskey(row scanner) (*models.Passkey, error) {
+	var passkey models.Passkey
+	var credential []byte
+	err := row.Scan(
+		&passkey.ID,
+		&passkey.UserID,
+		&passkey.CredentialID,
+		&passkey.Name,
+		&credential,
+		&passkey.SignCount,
+		&passkey.CreatedAt,
+		&passkey.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey.Credential = credential
+	return &passkey, nil
+}
+
+func replaceRecoveryCodes(q queryer, userID int, codeHashes []string) error {
+	if _, err := q.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		if _, err := q.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, codeHash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanSession(row scanner) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.FamilyID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
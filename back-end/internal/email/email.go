@@ -3,6 +3,7 @@ package email
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"subscription-tracker/internal/models"
 
@@ -22,6 +23,18 @@ type EmailService struct {
 	dialer *gomail.Dialer
 }
 
+// ConfigFromEnv returns the SMTP settings shared by every email the server
+// sends
+func ConfigFromEnv() EmailConfig {
+	return EmailConfig{
+		SMTPHost:     "smtp.gmail.com",
+		SMTPPort:     443,
+		SMTPUser:     os.Getenv("SMTP_USER"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		FromEmail:    os.Getenv("SMTP_FROM"),
+	}
+}
+
 func NewEmailService(config EmailConfig) *EmailService {
 	return &EmailService{
 		config: config,
@@ -58,3 +71,97 @@ func (es *EmailService) SendSubscriptionAlert(sub models.Subscription) error {
 	log.Printf("Email alert sent to %s for subscription %s", sub.Email, sub.Name)
 	return nil
 }
+
+func (es *EmailService) SendVerificationEmail(to, name, link string) error {
+	body := fmt.Sprintf(`
+	Hello %s,
+
+	Please confirm your email address by opening this link:
+
+	%s
+
+	The link expires in 24 hours. Until the address is confirmed we will not
+	send you renewal reminders.
+
+	Thank you,
+	Subscription Tracker
+	`, name, link)
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", es.config.FromEmail)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "Confirm your email address")
+	m.SetBody("text/plain", body)
+
+	if err := es.dialer.DialAndSend(m); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", to, err)
+		return err
+	}
+
+	log.Printf("Verification email sent to %s", to)
+	return nil
+}
+
+func (es *EmailService) SendPasswordResetEmail(to, name, link string) error {
+	body := fmt.Sprintf(`
+	Hello %s,
+
+	We received a request to reset the password of your account. Open this
+	link to choose a new one:
+
+	%s
+
+	The link expires in 30 minutes and can be used once. If you did not ask
+	for a reset, you can ignore this email.
+
+	Thank you,
+	Subscription Tracker
+	`, name, link)
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", es.config.FromEmail)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "Reset your password")
+	m.SetBody("text/plain", body)
+
+	if err := es.dialer.DialAndSend(m); err != nil {
+		log.Printf("Failed to send password reset email to %s: %v", to, err)
+		return err
+	}
+
+	log.Printf("Password reset email sent to %s", to)
+	return nil
+}
+
+// SendEmailChangeEmail asks the owner of a new address to confirm it before
+// the account switches to it
+func (es *EmailService) SendEmailChangeEmail(to, name, link string) error {
+	body := fmt.Sprintf(`
+	Hello %s,
+
+	We received a request to use this address for your Subscription Tracker
+	account. Open this link to confirm the change:
+
+	%s
+
+	The link expires in 24 hours. Until then your account keeps its current
+	email. If you did not ask for this, you can ignore this email.
+
+	Thank you,
+	Subscription Tracker
+	`, name, link)
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", es.config.FromEmail)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "Confirm your new email address")
+	m.SetBody("text/plain", body)
+
+	if err := es.dialer.DialAndSend(m); err != nil {
+		log.Printf("Failed to send email change confirmation to %s: %v", to, err)
+		return err
+	}
+
+	log.Printf("Email change confirmation sent to %s", to)
+	return nil
+}
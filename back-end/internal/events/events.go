@@ -0,0 +1,74 @@
+package events
+
+import (
+	"log"
+	"time"
+)
+
+// Event types
+const (
+	SubscriptionCreated = "subscription.created"
+	SubscriptionUpdated = "subscription.updated"
+	SubscriptionDeleted = "subscription.deleted"
+	RenewalUpcoming     = "renewal.upcoming"
+	RenewalCharged      = "renewal.charged"
+)
+
+// Types lists every event type that can be published
+var Types = []string{
+	SubscriptionCreated,
+	SubscriptionUpdated,
+	SubscriptionDeleted,
+	RenewalUpcoming,
+	RenewalCharged,
+}
+
+// Event is something that happened to a user's data
+type Event struct {
+	Type       string
+	UserID     int
+	Data       interface{}
+	OccurredAt time.Time
+}
+
+// Bus delivers published events to every subscriber in process. Subscribers
+// run synchronously, so they should hand slow work off to a worker.
+type Bus struct {
+	subscribers []func(Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers fn for every event. It must be called before the server
+// starts publishing.
+func (b *Bus) Subscribe(fn func(Event)) {
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// Publish sends an event to all subscribers. A nil Bus drops events, so
+// handlers can publish unconditionally.
+func (b *Bus) Publish(eventType string, userID int, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	event := Event{
+		Type:       eventType,
+		UserID:     userID,
+		Data:       data,
+		OccurredAt: time.Now().UTC(),
+	}
+
+	for _, fn := range b.subscribers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Event subscriber panicked on %s: %v", eventType, r)
+				}
+			}()
+			fn(event)
+		}()
+	}
+}
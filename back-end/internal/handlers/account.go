@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/utils"
+
+	"golang.org/x/oauth2"
+)
+
+// ExportAccount streams a zip archive with everything stored for the user:
+// profile, subscriptions, webhooks and their delivery logs, active sessions,
+// passkeys, two-factor status and calendar feed. Secrets, password and token
+// hashes and passkey credentials are left out.
+func ExportAccount(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		account, err := db.GetUserByEmail(user.Email)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		subscriptions, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		webhooks, err := db.GetUserWebhooks(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		deliveries, err := db.GetUserWebhookDeliveries(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		sessions, err := db.GetUserSessions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		passkeys, err := db.GetUserPasskeys(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		twoFactor := models.TwoFactorStatus{}
+		userTOTP, err := db.GetTOTP(user.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			problem.Internal(w, r, err)
+			return
+		}
+		if userTOTP != nil && userTOTP.EnabledAt != nil {
+			twoFactor.Enabled = true
+			twoFactor.RecoveryCodesLeft = userTOTP.RecoveryCodesLeft
+		}
+
+		calendarFeed, err := db.GetCalendarFeed(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		type exportFile struct {
+			name    string
+			content interface{}
+		}
+
+		now := time.Now().UTC()
+		files := []exportFile{
+			{"profile.json", models.AccountProfile{
+				ID:         account.ID,
+				Name:       account.Name,
+				Email:      account.Email,
+				ThirdParty: account.ThirdParty,
+				CreatedAt:  account.CreatedAt,
+				UpdatedAt:  account.UpdatedAt,
+			}},
+			{"subscriptions.json", subscriptions},
+			{"webhooks.json", webhooks},
+			{"webhook_deliveries.json", deliveries},
+			{"sessions.json", sessions},
+			{"passkeys.json", passkeys},
+			{"two_factor.json", twoFactor},
+			{"calendar_feed.json", calendarFeed},
+		}
+
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i] = file.name
+		}
+		manifest := exportFile{"manifest.json", map[string]interface{}{
+			"exportedAt": now,
+			"files":      names,
+		}}
+		files = append([]exportFile{manifest}, files...)
+
+		filename := fmt.Sprintf("subscription-tracker-export-%s.zip", now.Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		archive := zip.NewWriter(w)
+		for _, file := range files {
+			writer, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+			if err != nil {
+				log.Printf("Failed to write %s to account export: %v", file.name, err)
+				return
+			}
+
+			encoder := json.NewEncoder(writer)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(file.content); err != nil {
+				log.Printf("Failed to write %s to account export: %v", file.name, err)
+				return
+			}
+		}
+
+		if err := archive.Close(); err != nil {
+			log.Printf("Failed to finish account export: %v", err)
+		}
+	}
+}
+
+// DeleteAccount permanently removes the user after confirming their identity
+// with their password, or with a fresh Google sign-in for Google accounts
+func DeleteAccount(db models.Database, googleOauthConfig *oauth2.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.DeleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if !reauthenticate(w, r, db, googleOauthConfig, *user, req.Password, req.Code) {
+			return
+		}
+
+		err := db.DeleteUser(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		// Refresh tokens are checked against the user on every use, so they
+		// stop working once the user row is gone
+		clearRefreshCookie(w)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Helper functions
+
+// reauthenticate confirms the user's identity before a sensitive change, with
+// their password or with a fresh Google authorization code for Google
+// accounts. It writes the error response itself and reports whether the
+// change may go ahead.
+func reauthenticate(w http.ResponseWriter, r *http.Request, db models.Database, googleOauthConfig *oauth2.Config, user models.User, password string, code string) bool {
+	account, err := db.GetUserByEmail(user.Email)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return false
+	}
+
+	if account.ThirdParty == "google" {
+		if code == "" {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeReauthenticationRequired, "Sign in with Google again and send the authorization code")
+			return false
+		}
+
+		googleUser, err := fetchGoogleUser(googleOauthConfig, code)
+		if err != nil || googleUser.Email != account.Email {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Google re-authentication failed")
+			return false
+		}
+	} else if !utils.CheckPasswordHash(password, account.PasswordHash) {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid password")
+		return false
+	}
+
+	return true
+}
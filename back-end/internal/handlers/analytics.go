@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/analytics"
+	"subscription-tracker/internal/cache"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+)
+
+const forecastMonths = 12
+
+func GetSpendingTrend(db models.Database, cacheService *cache.CacheService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+		now := time.Now().UTC()
+
+		// Default to the last 12 months including the current one
+		to := now
+		from := now.AddDate(0, -(forecastMonths - 1), 0)
+
+		var err error
+		if value := r.URL.Query().Get("from"); value != "" {
+			from, err = analytics.ParseMonth(value)
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid from month, expected YYYY-MM")
+				return
+			}
+		}
+		if value := r.URL.Query().Get("to"); value != "" {
+			to, err = analytics.ParseMonth(value)
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid to month, expected YYYY-MM")
+				return
+			}
+		}
+		if to.Before(from) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "from must not be after to")
+			return
+		}
+		if to.Year()*12+int(to.Month())-from.Year()*12-int(from.Month()) >= 120 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Range must not exceed 120 months")
+			return
+		}
+
+		// The current month keeps filling up, so cached entries are only valid for the day
+		cacheField := "trend:" + from.Format("2006-01") + ":" + to.Format("2006-01") + ":" + now.Format("2006-01-02")
+		var cachedTrend models.SpendingTrend
+		if getCachedAnalytics(cacheService, user.ID, cacheField, &cachedTrend) {
+			writeAnalytics(w, true, cachedTrend)
+			return
+		}
+
+		subscriptions, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		trend := analytics.MonthlyTrend(subscriptions, from, to, now)
+		cacheAnalytics(cacheService, user.ID, cacheField, trend)
+
+		writeAnalytics(w, false, trend)
+	}
+}
+
+func GetSpendingBreakdown(db models.Database, cacheService *cache.CacheService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var cachedBreakdown models.SpendingBreakdown
+		if getCachedAnalytics(cacheService, user.ID, "breakdown", &cachedBreakdown) {
+			writeAnalytics(w, true, cachedBreakdown)
+			return
+		}
+
+		subscriptions, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		breakdown := analytics.Breakdown(subscriptions)
+		cacheAnalytics(cacheService, user.ID, "breakdown", breakdown)
+
+		writeAnalytics(w, false, breakdown)
+	}
+}
+
+func GetSpendingForecast(db models.Database, cacheService *cache.CacheService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+		now := time.Now().UTC()
+
+		// The forecast starts today, so cached entries are only valid for the day
+		cacheField := "forecast:" + now.Format("2006-01-02")
+		var cachedForecast models.SpendingForecast
+		if getCachedAnalytics(cacheService, user.ID, cacheField, &cachedForecast) {
+			writeAnalytics(w, true, cachedForecast)
+			return
+		}
+
+		subscriptions, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		forecast := analytics.Forecast(subscriptions, now, forecastMonths)
+		cacheAnalytics(cacheService, user.ID, cacheField, forecast)
+
+		writeAnalytics(w, false, forecast)
+	}
+}
+
+// Helper functions
+func getCachedAnalytics(cacheService *cache.CacheService, userID int, name string, dest interface{}) bool {
+	if cacheService == nil {
+		return false
+	}
+
+	return cacheService.GetCachedUserAnalytics(userID, name, dest) == nil
+}
+
+func cacheAnalytics(cacheService *cache.CacheService, userID int, name string, value interface{}) {
+	if cacheService == nil {
+		return
+	}
+
+	go func() {
+		err := cacheService.CacheUserAnalytics(userID, name, value)
+		if err != nil {
+			log.Printf("Failed to cache analytics: %v", err)
+		}
+	}()
+}
+
+func writeAnalytics(w http.ResponseWriter, cached bool, value interface{}) {
+	if cached {
+		w.Header().Set("X-Cache", "HIT")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
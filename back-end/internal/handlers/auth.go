@@ -2,21 +2,42 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
 	"subscription-tracker/internal/utils"
+	"subscription-tracker/internal/validation"
 
 	"golang.org/x/oauth2"
 )
 
+const (
+	refreshTokenTTL = 90 * 24 * time.Hour
+
+	// refreshTokenReuseGrace lets tabs that refresh at the same moment present
+	// the same token without it counting as reuse
+	refreshTokenReuseGrace = 10 * time.Second
+
+	// The refresh cookie is also needed by /logout to revoke the token
+	refreshCookiePath = "/api/v1"
+)
+
 func Register(db models.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.RegisterReq
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
 			return
 		}
 
@@ -24,14 +45,14 @@ func Register(db models.Database) http.HandlerFunc {
 		existingUser, _ := db.GetUserByEmail(req.Email)
 
 		if existingUser != nil {
-			http.Error(w, "User already exist", http.StatusConflict)
+			problem.Write(w, r, http.StatusConflict, problem.CodeEmailTaken, "An account with this email already exists")
 			return
 		}
 
 		// Create password hash
 		passwordHash, err := utils.HashPassword(req.Password)
 		if err != nil {
-			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
@@ -44,25 +65,22 @@ func Register(db models.Database) http.HandlerFunc {
 
 		createdUser, err := db.CreateUser(user)
 		if err != nil {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		// Generate token
-		token, err := utils.GenerateJWT(*createdUser)
+		// Start a session and generate its tokens
+		token, err := startSession(w, r, db, *createdUser)
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		refreshToken, err := utils.GenerateRefreshJWT(*createdUser)
-		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-			return
+		// Reminders are held back until the address is confirmed
+		if err := sendVerificationEmail(*createdUser); err != nil {
+			log.Printf("[%s] Failed to send verification email: %v", problem.RequestID(r.Context()), err)
 		}
 
-		setHTTPCookie(w, refreshToken)
-
 		response := models.AuthResponse{
 			Message: "User registered successfully",
 			Token:   token,
@@ -79,85 +97,58 @@ func Login(db models.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.LoginRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
 			return
 		}
 
 		// Getting user by email
 		user, err := db.GetUserByEmail(req.Email)
 		if err != nil {
-			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid email or password")
 			return
 		}
 
 		// Checking password
 		if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
-			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid email or password")
 			return
 		}
 
-		// Generate token
-		token, err := utils.GenerateJWT(*user)
-		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-			return
-		}
-
-		refreshToken, err := utils.GenerateRefreshJWT(*user)
-		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-			return
-		}
-
-		setHTTPCookie(w, refreshToken)
-
-		response := models.AuthResponse{
-			Message: "Login Successful",
-			Token:   token,
-			User:    *user,
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		completeSignIn(w, r, db, *user)
 	}
 }
 
 func AuthGoogle(db models.Database, googleOauthConfig *oauth2.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			Code string `json:"code"`
+			Code string `json:"code" validate:"required"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
 			return
 		}
 
-		// Exchange authorization code for tokens
-		googleToken, err := googleOauthConfig.Exchange(context.Background(), req.Code)
-		if err != nil {
-			http.Error(w, "Failed to exchange token", http.StatusBadRequest)
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
 			return
 		}
 
-		// Get user info from Google
-		client := googleOauthConfig.Client(context.Background(), googleToken)
-		resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+		googleUser, err := fetchGoogleUser(googleOauthConfig, req.Code)
 		if err != nil {
-			http.Error(w, "Failed to get user info", http.StatusBadRequest)
-			return
-		}
-		defer resp.Body.Close()
-
-		var googleUser models.GoogleUser
-		if err := json.NewDecoder(resp.Body).Decode(&googleUser); err != nil {
-			http.Error(w, "Failed to decode user info", http.StatusBadRequest)
+			log.Printf("[%s] Google sign-in failed: %v", problem.RequestID(r.Context()), err)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidCredentials, "Google sign-in failed")
 			return
 		}
 
 		// Get user by email
 		user, _ := db.GetUserByEmail(googleUser.Email)
 		// if err != nil {
-		// 	http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		// 	problem.Internal(w, r, err)
 		// 	return
 		// }
 
@@ -168,10 +159,11 @@ func AuthGoogle(db models.Database, googleOauthConfig *oauth2.Config) http.Handl
 			newUser.Name = googleUser.Name
 			newUser.PasswordHash = ""
 			newUser.ThirdParty = "google"
+			newUser.EmailVerified = googleUser.VerifiedEmail
 
 			createdUser, err := db.CreateUser(newUser)
 			if err != nil {
-				http.Error(w, "Failed to create user", http.StatusInternalServerError)
+				problem.Internal(w, r, err)
 				return
 			}
 
@@ -180,35 +172,82 @@ func AuthGoogle(db models.Database, googleOauthConfig *oauth2.Config) http.Handl
 
 		// User not registered by google auth
 		if user.ThirdParty != "google" {
-			http.Error(w, "Email already in use", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusConflict, problem.CodeEmailTaken, "An account with this email already exists")
 			return
 		}
 
-		// Generate token
-		token, err := utils.GenerateJWT(*user)
-		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-			return
-		}
+		completeSignIn(w, r, db, *user)
+	}
+}
 
-		// Generate token
-		refreshToken, err := utils.GenerateRefreshJWT(*user)
+// completeSignIn answers a sign-in whose first factor was accepted. Accounts
+// with two-factor authentication get a challenge to answer at /login/2fa,
+// other accounts get a session right away.
+func completeSignIn(w http.ResponseWriter, r *http.Request, db models.Database, user models.User) {
+	enabled, err := twoFactorEnabled(db, user.ID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	if enabled {
+		challengeToken, err := utils.GeneratePurposeJWT(user.ID, user.Email, utils.PurposeLoginChallenge, loginChallengeTTL)
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		setHTTPCookie(w, refreshToken)
-
-		response := models.AuthResponse{
-			Message: "Login Successful",
-			Token:   token,
-			User:    *user,
+		response := models.LoginChallenge{
+			Message:        "Enter a code from your authenticator app or a recovery code",
+			ChallengeToken: challengeToken,
+			Methods:        []string{"totp", "recovery_code"},
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
+		return
 	}
+
+	// Start a session and generate its tokens
+	token, err := startSession(w, r, db, user)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	response := models.AuthResponse{
+		Message: "Login Successful",
+		Token:   token,
+		User:    user,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// fetchGoogleUser exchanges an authorization code and returns the Google
+// profile it grants access to
+func fetchGoogleUser(googleOauthConfig *oauth2.Config, code string) (*models.GoogleUser, error) {
+	// Exchange authorization code for tokens
+	googleToken, err := googleOauthConfig.Exchange(context.Background(), code)
+	if err != nil {
+		return nil, errors.New("Failed to exchange token")
+	}
+
+	// Get user info from Google
+	client := googleOauthConfig.Client(context.Background(), googleToken)
+	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+	if err != nil {
+		return nil, errors.New("Failed to get user info")
+	}
+	defer resp.Body.Close()
+
+	var googleUser models.GoogleUser
+	if err := json.NewDecoder(resp.Body).Decode(&googleUser); err != nil {
+		return nil, errors.New("Failed to decode user info")
+	}
+
+	return &googleUser, nil
 }
 
 func GetUserDetail(db models.Database) http.HandlerFunc {
@@ -224,7 +263,7 @@ func setHTTPCookie(w http.ResponseWriter, refreshToken string) {
 	cookie := http.Cookie{
 		Name:     "refreshToken",
 		Value:    refreshToken,
-		Path:     "/api/v1/refresh",
+		Path:     refreshCookiePath,
 		Expires:  time.Now().Add(24 * time.Hour),
 		HttpOnly: true,
 		Secure:   true,
@@ -232,9 +271,26 @@ func setHTTPCookie(w http.ResponseWriter, refreshToken string) {
 	}
 
 	http.SetCookie(w, &cookie)
+	clearLegacyRefreshCookie(w)
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+func clearRefreshCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refreshToken",
+		Value:    "",
+		Path:     refreshCookiePath,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	clearLegacyRefreshCookie(w)
+}
+
+// clearLegacyRefreshCookie removes the cookie that used to be scoped to
+// /api/v1/refresh. Browsers send it first on /refresh, where it would shadow
+// the current one.
+func clearLegacyRefreshCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "refreshToken",
 		Value:    "",
@@ -244,40 +300,81 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		Secure:   true,
 		SameSite: http.SameSiteNoneMode,
 	})
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode("Logout successfull")
+// LogoutHandler revokes the refresh token, along with every token rotated
+// from the same login, and clears its cookie
+func LogoutHandler(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("refreshToken"); err == nil {
+			if err := db.RevokeRefreshTokenFamily(utils.HashToken(cookie.Value)); err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+		}
+
+		clearRefreshCookie(w)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.MessageResponse{Message: "Logout successful"})
+	}
 }
 
+// GenerateAccessToken exchanges the refresh token for an access token and
+// rotates it. Presenting a token that was already rotated revokes its family,
+// since either the client or an attacker holds a stolen copy.
 func GenerateAccessToken(db models.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("refreshToken")
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Refresh token cookie is missing")
 			return
 		}
 
-		claims, err := utils.ValidateJWT(cookie.Value)
+		refreshToken, err := utils.GenerateSecureToken()
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		user, err := db.GetUserByID(claims.UserID)
+		next := models.RefreshToken{TokenHash: utils.HashToken(refreshToken)}
+		rotated, err := db.RotateRefreshToken(utils.HashToken(cookie.Value), next, refreshTokenTTL, refreshTokenReuseGrace)
+		if errors.Is(err, models.ErrRefreshTokenReused) {
+			log.Printf("[%s] Refresh token reuse detected, revoked its family", problem.RequestID(r.Context()))
+			clearRefreshCookie(w)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Refresh token is invalid or expired")
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			clearRefreshCookie(w)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Refresh token is invalid or expired")
+			return
+		}
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		token, err := utils.GenerateJWT(*user)
+		session, err := db.TouchSession(rotated.FamilyID, userAgent(r), clientIP(r))
+		if errors.Is(err, sql.ErrNoRows) {
+			clearRefreshCookie(w)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Refresh token is invalid or expired")
+			return
+		}
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		refreshToken, err := utils.GenerateRefreshJWT(*user)
+		user, err := db.GetUserByID(rotated.UserID)
 		if err != nil {
-			http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Refresh token is invalid or expired")
+			return
+		}
+
+		token, err := utils.GenerateJWT(*user, session.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
 			return
 		}
 
@@ -292,3 +389,38 @@ func GenerateAccessToken(db models.Database) http.HandlerFunc {
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// Helper functions
+
+// startSession records a sign-in from the requesting client, sets the
+// cookie with the first refresh token of its family and returns an access
+// token for it
+func startSession(w http.ResponseWriter, r *http.Request, db models.Database, user models.User) (string, error) {
+	refreshToken, err := utils.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	familyID, err := utils.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	session, err := db.CreateSession(models.Session{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		UserAgent: userAgent(r),
+		IPAddress: clientIP(r),
+	}, utils.HashToken(refreshToken), refreshTokenTTL)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := utils.GenerateJWT(user, session.ID)
+	if err != nil {
+		return "", err
+	}
+
+	setHTTPCookie(w, refreshToken)
+	return token, nil
+}
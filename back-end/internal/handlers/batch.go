@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"subscription-tracker/internal/catalog"
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/validation"
+)
+
+// Batch modes
+const (
+	batchAtomic     = "atomic"
+	batchBestEffort = "bestEffort"
+)
+
+// BatchSubscriptions applies mixed create, update and delete operations in one
+// request. Invalid operations are reported without touching the database; in
+// atomic mode any invalid operation rejects the whole batch. Updates and
+// deletes must carry the version they are based on, like If-Match on the
+// single-item endpoints.
+func BatchSubscriptions(db models.Database, serviceCatalog *catalog.Catalog, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+		if req.Mode == "" {
+			req.Mode = batchAtomic
+		}
+
+		atomic := req.Mode == batchAtomic
+		response := models.BatchResponse{
+			Mode:    req.Mode,
+			Results: make([]models.BatchResult, len(req.Operations)),
+		}
+
+		var valid []models.BatchOperation
+		var validIndexes []int
+		for i := range req.Operations {
+			op := &req.Operations[i]
+			if status, errs := validateBatchOperation(serviceCatalog, op); len(errs) > 0 {
+				response.Results[i] = models.BatchResult{
+					Index:  i,
+					Op:     op.Op,
+					ID:     op.ID,
+					Status: status,
+					Errors: errs,
+				}
+				continue
+			}
+
+			valid = append(valid, *op)
+			validIndexes = append(validIndexes, i)
+		}
+
+		if atomic && len(valid) < len(req.Operations) {
+			for _, i := range validIndexes {
+				response.Results[i] = models.BatchResult{
+					Index:  i,
+					Op:     req.Operations[i].Op,
+					ID:     req.Operations[i].ID,
+					Status: http.StatusFailedDependency,
+					Errors: []string{"not attempted because another operation is invalid"},
+				}
+			}
+			valid = nil
+		}
+
+		if len(valid) > 0 {
+			results, committed, err := db.BatchSubscriptions(user.ID, valid, atomic)
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+
+			for j, result := range results {
+				result.Index = validIndexes[j]
+				result.Status, result.Errors = batchStatus(r, result)
+				response.Results[validIndexes[j]] = result
+			}
+			response.Committed = committed
+		}
+
+		for _, result := range response.Results {
+			if result.Status < 300 && response.Committed {
+				response.Succeeded++
+				publishBatchResult(bus, user.ID, result)
+			} else {
+				response.Failed++
+			}
+		}
+
+		status := http.StatusOK
+		if atomic && !response.Committed {
+			status = http.StatusUnprocessableEntity
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func publishBatchResult(bus *events.Bus, userID int, result models.BatchResult) {
+	switch result.Op {
+	case models.BatchCreate:
+		bus.Publish(events.SubscriptionCreated, userID, result.Subscription)
+	case models.BatchUpdate:
+		bus.Publish(events.SubscriptionUpdated, userID, result.Subscription)
+	case models.BatchDelete:
+		bus.Publish(events.SubscriptionDeleted, userID, models.SubscriptionDeletedEvent{ID: result.ID})
+	}
+}
+
+// batchStatus maps the outcome of an operation that was run to the status
+// and errors the single-item endpoint would answer with
+func batchStatus(r *http.Request, result models.BatchResult) (int, []string) {
+	switch {
+	case result.Err == nil && result.Op == models.BatchCreate:
+		return http.StatusCreated, nil
+	case result.Err == nil && result.Op == models.BatchDelete:
+		return http.StatusNoContent, nil
+	case result.Err == nil:
+		return http.StatusOK, nil
+	case errors.Is(result.Err, models.ErrBatchRolledBack), errors.Is(result.Err, models.ErrBatchNotAttempted):
+		return http.StatusFailedDependency, []string{result.Err.Error()}
+	case errors.Is(result.Err, sql.ErrNoRows):
+		return http.StatusNotFound, []string{"subscription not found"}
+	case errors.Is(result.Err, models.ErrVersionConflict):
+		return http.StatusConflict, []string{"subscription version is not current"}
+	default:
+		log.Printf("[%s] Batch %s failed: %v", problem.RequestID(r.Context()), result.Op, result.Err)
+		return http.StatusInternalServerError, []string{"failed to " + result.Op + " subscription"}
+	}
+}
+
+// validateBatchOperation returns the errors of an operation and the status
+// to report them with
+func validateBatchOperation(serviceCatalog *catalog.Catalog, op *models.BatchOperation) (int, []string) {
+	switch op.Op {
+	case models.BatchCreate, models.BatchUpdate:
+		if op.Op == models.BatchUpdate {
+			if op.ID <= 0 {
+				return http.StatusBadRequest, []string{"id is required for update"}
+			}
+			if op.Version == 0 && op.Subscription.Version != nil {
+				op.Version = *op.Subscription.Version
+			}
+			if op.Version <= 0 {
+				return http.StatusPreconditionRequired, []string{"version is required for update"}
+			}
+		}
+		if err := applyCatalogPlan(serviceCatalog, &op.Subscription); err != nil {
+			return http.StatusBadRequest, []string{err.Error()}
+		}
+		return http.StatusBadRequest, validation.Messages(validation.Struct(op.Subscription))
+	case models.BatchDelete:
+		if op.ID <= 0 {
+			return http.StatusBadRequest, []string{"id is required for delete"}
+		}
+		if op.Version <= 0 {
+			return http.StatusPreconditionRequired, []string{"version is required for delete"}
+		}
+		return http.StatusOK, nil
+	default:
+		return http.StatusBadRequest, []string{"op must be create, update or delete"}
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/analytics"
+	"subscription-tracker/internal/ical"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const maxCalendarDays = 366
+
+func GetCalendar(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		// Default to the current calendar month
+		now := time.Now().UTC()
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		to := from.AddDate(0, 1, -1)
+
+		var err error
+		if value := r.URL.Query().Get("from"); value != "" {
+			from, err = analytics.ParseDate(value)
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid from date, expected YYYY-MM-DD")
+				return
+			}
+		}
+		if value := r.URL.Query().Get("to"); value != "" {
+			to, err = analytics.ParseDate(value)
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid to date, expected YYYY-MM-DD")
+				return
+			}
+		}
+		if to.Before(from) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "from must not be after to")
+			return
+		}
+		if to.Sub(from) >= maxCalendarDays*24*time.Hour {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Range must not exceed 366 days")
+			return
+		}
+
+		subscriptions, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		calendar := analytics.ProjectCalendar(subscriptions, from, to)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(calendar)
+	}
+}
+
+// RotateCalendarFeed issues a new secret feed URL, replacing any previous one.
+// Only the token hash is stored, so the URL is shown once.
+func RotateCalendarFeed(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		token, err := utils.GenerateSecureToken()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		err = db.SetCalendarFeedToken(user.ID, utils.HashToken(token))
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		response := models.CalendarFeedResponse{
+			Message: "Calendar feed created",
+			URL:     publicBaseURL(r) + "/api/v1/calendar/feed/" + token + ".ics",
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func RevokeCalendarFeed(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		err := db.DeleteCalendarFeedToken(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetCalendarFeed serves the iCalendar feed. Calendar clients can't send the
+// Authorization header, so the secret token in the URL is the credential.
+func GetCalendarFeed(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := mux.Vars(r)["token"]
+
+		user, err := db.GetUserByCalendarFeedToken(utils.HashToken(token))
+		if err != nil {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Calendar feed not found")
+			return
+		}
+
+		subscriptions, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		feed := ical.BuildFeed(user.Name+" subscriptions", subscriptions, time.Now())
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="subscriptions.ics"`)
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		w.Write(feed)
+	}
+}
+
+// Helper functions
+func publicBaseURL(r *http.Request) string {
+	if baseURL := os.Getenv("PUBLIC_API_URL"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"subscription-tracker/internal/catalog"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+
+	"github.com/gorilla/mux"
+)
+
+const defaultCatalogLimit = 10
+
+func SearchCatalog(serviceCatalog *catalog.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultCatalogLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 100 {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 100")
+				return
+			}
+			limit = parsed
+		}
+
+		services := serviceCatalog.Search(r.URL.Query().Get("q"), limit)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(services)
+	}
+}
+
+func GetCatalogService(serviceCatalog *catalog.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		service, ok := serviceCatalog.Service(mux.Vars(r)["id"])
+		if !ok {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Service not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service)
+	}
+}
+
+// SaveCatalogService creates or replaces a catalog service (admin only)
+func SaveCatalogService(serviceCatalog *catalog.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var service models.CatalogService
+		if err := json.NewDecoder(r.Body).Decode(&service); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+		service.ID = mux.Vars(r)["id"]
+
+		if errs := catalog.Validate(service); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		if err := serviceCatalog.Save(service); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(service)
+	}
+}
+
+// DeleteCatalogService removes a service from the catalog (admin only)
+func DeleteCatalogService(serviceCatalog *catalog.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := serviceCatalog.Delete(mux.Vars(r)["id"])
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Service not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// applyCatalogPlan fills the fields left empty in req from the catalog plan it
+// references. Fields sent explicitly take precedence.
+func applyCatalogPlan(serviceCatalog *catalog.Catalog, req *models.CreateSubscriptionRequest) error {
+	if req.CatalogPlanID == "" || serviceCatalog == nil {
+		return nil
+	}
+
+	service, plan, ok := serviceCatalog.Plan(req.CatalogPlanID)
+	if !ok {
+		return errors.New("catalogPlanId does not match a catalog plan")
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		req.Name = service.Name
+	}
+	if strings.TrimSpace(req.Category) == "" {
+		req.Category = service.Category
+	}
+	if req.Price == 0 {
+		req.Price = plan.Price
+	}
+	if req.BillingCycle == "" {
+		req.BillingCycle = plan.BillingCycle
+	}
+
+	return nil
+}
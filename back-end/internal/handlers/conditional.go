@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/cache"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+)
+
+// userDataVersion returns the user's data version, or false without Redis,
+// in which case responses carry no validators. It must be read before the
+// data it describes, so a concurrent change can only make the ETag older
+// than the body, never newer.
+func userDataVersion(cacheService *cache.CacheService, userID int) (time.Time, bool) {
+	if cacheService == nil {
+		return time.Time{}, false
+	}
+
+	version, err := cacheService.GetUserDataVersion(userID)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return version, true
+}
+
+// notModified sets etag and Last-Modified and answers 304 Not Modified when
+// the client's copy is still current. It reports whether the response has
+// been written.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	lastModified := modified.UTC().Truncate(time.Second)
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if !isNotModified(r, etag, lastModified) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// expectedVersion returns the subscription version a write is based on, from
+// If-Match or else from fallback, a version sent in the body or query. One of
+// them is required: without both it answers 428 and returns ok false. If-Match
+// "*" gives 0, which matches any version, and an If-Match that can't be a
+// subscription ETag gives -1, which matches none.
+func expectedVersion(w http.ResponseWriter, r *http.Request, fallback *int) (version int, fromHeader bool, ok bool) {
+	if header := strings.TrimSpace(r.Header.Get("If-Match")); header != "" {
+		if header == "*" {
+			return 0, true, true
+		}
+		version, err := strconv.Atoi(strings.Trim(header, `"`))
+		if err != nil || version < 1 || header != subscriptionETag(version) {
+			return -1, true, true
+		}
+		return version, true, true
+	}
+
+	if fallback != nil {
+		return *fallback, false, true
+	}
+
+	problem.Write(w, r, http.StatusPreconditionRequired, problem.CodePreconditionRequired, "Send If-Match with the subscription ETag or the version it is based on")
+	return 0, false, false
+}
+
+// writeVersionConflict answers a write based on a stale version with the
+// current subscription: 412 when the version came from If-Match, 409 when it
+// came from the request itself
+func writeVersionConflict(w http.ResponseWriter, r *http.Request, db models.Database, id int, userID int, fromHeader bool) {
+	current, err := db.GetSubscriptionByID(id)
+	if err != nil || current.UserID != userID {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Subscription not found")
+		return
+	}
+
+	p := problem.New(r, http.StatusConflict, problem.CodeVersionConflict, "The subscription was changed by another request; the current version is included")
+	if fromHeader {
+		p = problem.New(r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "If-Match does not match the current version; the current subscription is included")
+	}
+	p.Current = current
+
+	w.Header().Set("ETag", subscriptionETag(current.Version))
+	problem.Send(w, p)
+}
+
+// subscriptionETag is the strong ETag of a subscription, its quoted version
+func subscriptionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// Helper functions
+func userDataETag(userID int, version time.Time, resource string) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d:%d:%s", userID, version.UnixNano(), resource)))
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// isNotModified follows RFC 9110: If-None-Match wins when present, and
+// If-Modified-Since is only used without it
+func isNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagListMatches(header, etag)
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		return err == nil && !lastModified.After(since)
+	}
+
+	return false
+}
+
+// etagListMatches checks a comma-separated If-None-Match value using weak
+// comparison, which ignores the W/ prefix
+func etagListMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"subscription-tracker/internal/openapi"
+)
+
+func GetOpenAPISpec() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openapi.Spec)
+	}
+}
+
+func GetAPIDocs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(openapi.DocsPage)
+	}
+}
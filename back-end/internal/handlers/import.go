@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/importer"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/validation"
+)
+
+const maxImportSize = 5 << 20 // 5 MB
+
+// Duplicate handling modes for imports
+const (
+	duplicateSkip   = "skip"
+	duplicateUpdate = "update"
+	duplicateCreate = "create"
+)
+
+func ExportSubscriptions(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "format must be csv or json")
+			return
+		}
+
+		subscriptions, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.`+format+`"`)
+
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(subscriptions)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(w)
+		writer.Write(importer.Fields)
+		for _, sub := range subscriptions {
+			writer.Write([]string{
+				importer.EscapeCell(sub.Name),
+				importer.EscapeCell(sub.Category),
+				strconv.FormatFloat(sub.Price, 'f', 2, 64),
+				sub.BillingCycle,
+				sub.NextBillingDate.Format("2006-01-02"),
+				strconv.FormatBool(sub.IsActive),
+			})
+		}
+		writer.Flush()
+	}
+}
+
+// ImportSubscriptions accepts a CSV or JSON body. Query parameters:
+//   - format: csv or json (defaults to the Content-Type)
+//   - mapping: field:Column pairs, e.g. name:Service,price:Cost
+//   - onDuplicate: skip (default), update or create for names that already exist.
+//     Updates are checked against the version matched, so the import fails
+//     with 409 if one of the subscriptions changes while it runs. With update,
+//     only the first row of a name updates it and later ones are errors.
+//   - dryRun: true to preview the result without writing
+func ImportSubscriptions(db models.Database, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+		query := r.URL.Query()
+
+		format := query.Get("format")
+		if format == "" {
+			format = "json"
+			if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+				format = "csv"
+			}
+		}
+		if format != "json" && format != "csv" {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "format must be csv or json")
+			return
+		}
+
+		onDuplicate := query.Get("onDuplicate")
+		if onDuplicate == "" {
+			onDuplicate = duplicateSkip
+		}
+		if onDuplicate != duplicateSkip && onDuplicate != duplicateUpdate && onDuplicate != duplicateCreate {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "onDuplicate must be skip, update or create")
+			return
+		}
+
+		dryRun, _ := strconv.ParseBool(query.Get("dryRun"))
+
+		mapping, err := importer.ParseMapping(query.Get("mapping"))
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
+			return
+		}
+
+		body := http.MaxBytesReader(w, r.Body, maxImportSize)
+		var records []importer.Record
+		if format == "csv" {
+			records, err = importer.ParseCSV(body, mapping)
+		} else {
+			records, err = importer.ParseJSON(body, mapping)
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidFile, err.Error())
+			return
+		}
+
+		existing, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		existingByName := map[string]models.Subscription{}
+		for _, sub := range existing {
+			existingByName[normalizeName(sub.Name)] = sub
+		}
+
+		result := models.ImportResult{DryRun: dryRun, Rows: []models.ImportRowResult{}}
+		imported := map[string]int{} // row that first imported each name
+		var items []models.SubscriptionImport
+		var itemRows []int
+
+		for _, record := range records {
+			req, active, errs := record.ToRequest()
+			errs = append(errs, validation.Messages(validation.Struct(req))...)
+
+			row := models.ImportRowResult{Row: record.Row, Subscription: &req, IsActive: active}
+			if len(errs) > 0 {
+				row.Action = "error"
+				row.Errors = errs
+				result.Failed++
+				result.Rows = append(result.Rows, row)
+				continue
+			}
+
+			key := normalizeName(req.Name)
+			match, duplicate := existingByName[key]
+			firstRow, repeated := imported[key]
+			switch {
+			case duplicate && repeated && onDuplicate == duplicateUpdate:
+				// Only one row can update a subscription, the others would
+				// overwrite it
+				row.Action = "error"
+				row.Errors = []string{fmt.Sprintf("row %d already updates %q", firstRow, match.Name)}
+				result.Failed++
+				result.Rows = append(result.Rows, row)
+				continue
+			case !duplicate && repeated && onDuplicate != duplicateCreate:
+				// Repeats an earlier row of this import
+				row.Action = "skip"
+				result.Skipped++
+			case duplicate && onDuplicate == duplicateSkip:
+				row.Action = "skip"
+				row.SubscriptionID = match.ID
+				result.Skipped++
+			case duplicate && onDuplicate == duplicateUpdate:
+				row.Action = "update"
+				row.SubscriptionID = match.ID
+				result.Updated++
+				items = append(items, models.SubscriptionImport{ID: match.ID, Version: match.Version, Request: req, IsActive: active})
+				itemRows = append(itemRows, len(result.Rows))
+			default:
+				row.Action = "create"
+				result.Created++
+				items = append(items, models.SubscriptionImport{Request: req, IsActive: active})
+				itemRows = append(itemRows, len(result.Rows))
+			}
+			if !repeated {
+				imported[key] = record.Row
+			}
+
+			result.Rows = append(result.Rows, row)
+		}
+
+		if !dryRun && len(items) > 0 {
+			subscriptions, err := db.ImportSubscriptions(user.ID, items)
+			if errors.Is(err, models.ErrVersionConflict) {
+				problem.Write(w, r, http.StatusConflict, problem.CodeVersionConflict, "A subscription changed while importing, nothing was imported. Run the import again.")
+				return
+			}
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+
+			for i, sub := range subscriptions {
+				result.Rows[itemRows[i]].SubscriptionID = sub.ID
+
+				eventType := events.SubscriptionCreated
+				if items[i].ID != 0 {
+					eventType = events.SubscriptionUpdated
+				}
+				bus.Publish(eventType, user.ID, sub)
+			}
+		}
+
+		status := http.StatusOK
+		if !dryRun && len(items) > 0 {
+			status = http.StatusCreated
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// Helper functions
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"subscription-tracker/internal/catalog"
+	"subscription-tracker/internal/insights"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+)
+
+func GetDuplicateInsights(db models.Database, serviceCatalog *catalog.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		subscriptions, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		report := insights.FindDuplicates(subscriptions, catalogResolver(serviceCatalog))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// catalogResolver avoids handing the analyzer a typed nil when the catalog is
+// not configured
+func catalogResolver(serviceCatalog *catalog.Catalog) insights.Resolver {
+	if serviceCatalog == nil {
+		return nil
+	}
+	return serviceCatalog
+}
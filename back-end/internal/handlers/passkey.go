@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/passkey"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/ratelimit"
+	"subscription-tracker/internal/utils"
+	"subscription-tracker/internal/validation"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxPasskeysPerUser = 10
+
+	// Passkey sign-ins a client can start per minute
+	passkeyLoginsPerMinute = 20
+)
+
+// GetPasskeys lists the passkeys registered to the user
+func GetPasskeys(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		passkeys, err := db.GetUserPasskeys(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(passkeys)
+	}
+}
+
+// BeginPasskeyRegistration starts adding a passkey to the user's account.
+// The options are passed to navigator.credentials.create in the browser.
+func BeginPasskeyRegistration(db models.Database, webAuthn *webauthn.WebAuthn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		passkeys, err := db.GetUserPasskeys(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if len(passkeys) >= maxPasskeysPerUser {
+			problem.Write(w, r, http.StatusConflict, problem.CodeLimitReached, fmt.Sprintf("You can register at most %d passkeys", maxPasskeysPerUser))
+			return
+		}
+
+		handle := make([]byte, 64)
+		if _, err := rand.Read(handle); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		handle, err = db.SetWebAuthnID(user.ID, handle)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		webAuthnUser, err := passkey.NewUser(*user, handle, passkeys)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		// Passkeys are discoverable credentials that verify the user, so they
+		// can sign in without a password or second factor
+		creation, session, err := webAuthn.BeginRegistration(webAuthnUser,
+			webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+			webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+				ResidentKey:      protocol.ResidentKeyRequirementRequired,
+				UserVerification: protocol.VerificationRequired,
+			}),
+			webauthn.WithExclusions(webauthn.Credentials(webAuthnUser.Credentials).CredentialDescriptors()),
+		)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		ceremonyID, err := startCeremony(db, passkey.CeremonyRegistration, user.ID, session)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.PasskeyCeremonyResponse{CeremonyID: ceremonyID, Options: creation})
+	}
+}
+
+// FinishPasskeyRegistration stores the passkey the browser created
+func FinishPasskeyRegistration(db models.Database, webAuthn *webauthn.WebAuthn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.FinishPasskeyRegistrationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		ceremony, err := db.ConsumeWebAuthnCeremony(utils.HashToken(req.CeremonyID), passkey.CeremonyRegistration)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && ceremony.UserID != user.ID) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Passkey registration expired, try again")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		var session webauthn.SessionData
+		if err := json.Unmarshal(ceremony.Session, &session); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		passkeys, err := db.GetUserPasskeys(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		webAuthnUser, err := passkey.NewUser(*user, session.UserID, passkeys)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Passkey response is invalid")
+			return
+		}
+
+		credential, err := webAuthn.CreateCredential(webAuthnUser, session, parsed)
+		if err != nil {
+			log.Printf("[%s] Passkey registration failed: %v", problem.RequestID(r.Context()), err)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Passkey could not be verified")
+			return
+		}
+
+		record, err := json.Marshal(credential)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		name := req.Name
+		if name == "" {
+			name = "Passkey"
+		}
+
+		created, err := db.CreatePasskey(models.Passkey{
+			UserID:       user.ID,
+			CredentialID: credential.ID,
+			Name:         name,
+			Credential:   record,
+			SignCount:    credential.Authenticator.SignCount,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusConflict, problem.CodeBadRequest, "This passkey is already registered")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	}
+}
+
+// DeletePasskey removes one of the user's passkeys
+func DeletePasskey(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid passkey ID")
+			return
+		}
+
+		err = db.DeletePasskey(id, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Passkey not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// BeginPasskeyLogin starts a passwordless sign-in. The options are passed to
+// navigator.credentials.get, which lets the user pick any of their passkeys.
+func BeginPasskeyLogin(db models.Database, webAuthn *webauthn.WebAuthn, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, retryAfter := limiter.Allow("passkey-login:ip:"+clientIP(r), passkeyLoginsPerMinute, time.Minute); !ok {
+			writeRateLimited(w, r, retryAfter, "Too many sign-in attempts")
+			return
+		}
+
+		assertion, session, err := webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		ceremonyID, err := startCeremony(db, passkey.CeremonyLogin, 0, session)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.PasskeyCeremonyResponse{CeremonyID: ceremonyID, Options: assertion})
+	}
+}
+
+// FinishPasskeyLogin verifies the passkey's assertion and signs the user in
+// like Login. Passkeys verify the user themselves, so no second factor is
+// asked for.
+func FinishPasskeyLogin(db models.Database, webAuthn *webauthn.WebAuthn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.FinishPasskeyLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		ceremony, err := db.ConsumeWebAuthnCeremony(utils.HashToken(req.CeremonyID), passkey.CeremonyLogin)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Passkey sign-in expired, try again")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		var session webauthn.SessionData
+		if err := json.Unmarshal(ceremony.Session, &session); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Passkey response is invalid")
+			return
+		}
+
+		// Only the passkey that signed is loaded, and it must belong to the
+		// user the authenticator named
+		var stored *models.Passkey
+		var webAuthnUser *passkey.User
+		findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+			found, err := db.GetPasskeyByCredentialID(rawID)
+			if err != nil {
+				return nil, err
+			}
+
+			account, err := db.GetUserByWebAuthnID(userHandle)
+			if err != nil {
+				return nil, err
+			}
+			if account.ID != found.UserID {
+				return nil, errors.New("passkey belongs to another user")
+			}
+
+			stored = found
+			webAuthnUser, err = passkey.NewUser(*account, userHandle, []models.Passkey{*found})
+			return webAuthnUser, err
+		}
+
+		credential, err := webAuthn.ValidateDiscoverableLogin(findUser, session, parsed)
+		if err != nil {
+			log.Printf("[%s] Passkey sign-in failed: %v", problem.RequestID(r.Context()), err)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Passkey sign-in failed")
+			return
+		}
+
+		// A counter that didn't grow means the passkey may have been copied
+		if credential.Authenticator.CloneWarning {
+			log.Printf("[%s] Passkey %d of user %d sent a stale signature counter", problem.RequestID(r.Context()), stored.ID, stored.UserID)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Passkey sign-in failed")
+			return
+		}
+
+		record, err := json.Marshal(credential)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		err = db.UpdatePasskeyUsage(stored.ID, credential.Authenticator.SignCount, record)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Passkey sign-in failed")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		// Start a session and generate its tokens
+		token, err := startSession(w, r, db, webAuthnUser.Account)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		response := models.AuthResponse{
+			Message: "Login Successful",
+			Token:   token,
+			User:    webAuthnUser.Account,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// Helper functions
+
+// startCeremony stores the session of a ceremony and returns the ID the
+// client finishes it with
+func startCeremony(db models.Database, kind string, userID int, session *webauthn.SessionData) (string, error) {
+	ceremonyID, err := utils.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.CreateWebAuthnCeremony(models.WebAuthnCeremony{
+		IDHash:  utils.HashToken(ceremonyID),
+		UserID:  userID,
+		Kind:    kind,
+		Session: data,
+	}, passkey.CeremonyTTL)
+	if err != nil {
+		return "", err
+	}
+
+	return ceremonyID, nil
+}
@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/passkey"
+	"subscription-tracker/internal/ratelimit"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+const testOrigin = "http://localhost:3000"
+
+// TestPasskeyCeremonies registers a passkey with a software authenticator,
+// signs in with it and checks that a stale signature counter is rejected
+func TestPasskeyCeremonies(t *testing.T) {
+	webAuthn, err := passkey.New(passkey.Config{RPID: "localhost", RPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newPasskeyDB(models.User{ID: 7, Name: "Ada", Email: "ada@example.com"})
+	limiter := ratelimit.NewLimiter(nil)
+
+	// Register two passkeys on the same account
+	var authenticator *softAuthenticator
+	for _, name := range []string{"Laptop", "Phone"} {
+		authenticator = newSoftAuthenticator(t, "localhost")
+
+		options := beginCeremony(t, db.withUser(BeginPasskeyRegistration(db, webAuthn)))
+		credential := authenticator.create(t, options)
+
+		body, _ := json.Marshal(map[string]interface{}{"ceremonyId": options.CeremonyID, "name": name, "credential": credential})
+		rec := serve(db.withUser(FinishPasskeyRegistration(db, webAuthn)), body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("registering %s: status %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+	if len(db.passkeys) != 2 {
+		t.Fatalf("stored %d passkeys, want 2", len(db.passkeys))
+	}
+
+	// Sign in with the second passkey
+	signIn := func(counter uint32) *httptest.ResponseRecorder {
+		options := beginCeremony(t, BeginPasskeyLogin(db, webAuthn, limiter))
+		credential := authenticator.get(t, options, counter)
+
+		body, _ := json.Marshal(map[string]interface{}{"ceremonyId": options.CeremonyID, "credential": credential})
+		return serve(FinishPasskeyLogin(db, webAuthn), body)
+	}
+
+	rec := signIn(5)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sign-in: status %d: %s", rec.Code, rec.Body)
+	}
+	var response models.AuthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Token == "" || response.User.ID != 7 {
+		t.Fatalf("sign-in returned %+v", response)
+	}
+	if !hasRefreshCookie(rec) {
+		t.Fatal("sign-in did not set the refresh token cookie")
+	}
+	if db.sessions != 1 {
+		t.Fatalf("started %d sessions, want 1", db.sessions)
+	}
+
+	// A counter at or below the stored one means the key may be cloned
+	for _, counter := range []uint32{5, 3} {
+		if rec := signIn(counter); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("sign-in with counter %d: status %d, want 401", counter, rec.Code)
+		}
+	}
+
+	if rec := signIn(6); rec.Code != http.StatusOK {
+		t.Fatalf("sign-in with counter 6: status %d: %s", rec.Code, rec.Body)
+	}
+	if db.sessions != 2 {
+		t.Fatalf("started %d sessions, want 2", db.sessions)
+	}
+}
+
+// TestPasskeyCeremonyIsSingleUse replays a finished sign-in
+func TestPasskeyCeremonyIsSingleUse(t *testing.T) {
+	webAuthn, err := passkey.New(passkey.Config{RPID: "localhost", RPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newPasskeyDB(models.User{ID: 7, Name: "Ada", Email: "ada@example.com"})
+	authenticator := newSoftAuthenticator(t, "localhost")
+
+	options := beginCeremony(t, db.withUser(BeginPasskeyRegistration(db, webAuthn)))
+	body, _ := json.Marshal(map[string]interface{}{"ceremonyId": options.CeremonyID, "credential": authenticator.create(t, options)})
+	if rec := serve(db.withUser(FinishPasskeyRegistration(db, webAuthn)), body); rec.Code != http.StatusCreated {
+		t.Fatalf("registering: status %d: %s", rec.Code, rec.Body)
+	}
+
+	options = beginCeremony(t, BeginPasskeyLogin(db, webAuthn, ratelimit.NewLimiter(nil)))
+	body, _ = json.Marshal(map[string]interface{}{"ceremonyId": options.CeremonyID, "credential": authenticator.get(t, options, 1)})
+	if rec := serve(FinishPasskeyLogin(db, webAuthn), body); rec.Code != http.StatusOK {
+		t.Fatalf("sign-in: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(FinishPasskeyLogin(db, webAuthn), body); rec.Code != http.StatusBadRequest {
+		t.Fatalf("replayed sign-in: status %d, want 400", rec.Code)
+	}
+}
+
+// Helper functions
+
+type ceremonyOptions struct {
+	CeremonyID string `json:"ceremonyId"`
+	Options    struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func beginCeremony(t *testing.T, handler http.HandlerFunc) ceremonyOptions {
+	t.Helper()
+
+	rec := serve(handler, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("begin ceremony: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var options ceremonyOptions
+	if err := json.Unmarshal(rec.Body.Bytes(), &options); err != nil {
+		t.Fatal(err)
+	}
+	return options
+}
+
+func serve(handler http.HandlerFunc, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func hasRefreshCookie(rec *httptest.ResponseRecorder) bool {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "refreshToken" && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator is a platform authenticator in memory holding one P-256
+// passkey. It signs with "none" attestation and always verifies the user.
+type softAuthenticator struct {
+	rpIDHash     [32]byte
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   string
+}
+
+func newSoftAuthenticator(t *testing.T, rpID string) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialID := make([]byte, 32)
+	rand.Read(credentialID)
+
+	return &softAuthenticator{rpIDHash: sha256.Sum256([]byte(rpID)), key: key, credentialID: credentialID}
+}
+
+// authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+func (a *softAuthenticator) authenticatorData(flags byte, counter uint32) []byte {
+	data := append([]byte{}, a.rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, counter)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, kind string, challenge string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{"type": kind, "challenge": challenge, "origin": testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create answers navigator.credentials.create
+func (a *softAuthenticator) create(t *testing.T, options ceremonyOptions) map[string]interface{} {
+	t.Helper()
+
+	a.userHandle = options.Options.PublicKey.User.ID
+
+	publicKey, err := a.key.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// COSE EC2 key: kty 2, alg ES256, crv P-256, x, y
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{1: 2, 3: -7, -1: 1, -2: publicKey[1:33], -3: publicKey[33:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified|flagAttestedData, 0)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{"fmt": "none", "attStmt": map[string]interface{}{}, "authData": authData})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(a.clientData(t, "webauthn.create", options.Options.PublicKey.Challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	}
+}
+
+// get answers navigator.credentials.get with the signature counter given
+func (a *softAuthenticator) get(t *testing.T, options ceremonyOptions, counter uint32) map[string]interface{} {
+	t.Helper()
+
+	clientData := a.clientData(t, "webauthn.get", options.Options.PublicKey.Challenge)
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified, counter)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        a.userHandle,
+		},
+	}
+}
+
+// passkeyDB keeps one user's passkeys and ceremonies in memory. Other
+// methods of models.Database are not implemented.
+type passkeyDB struct {
+	models.Database
+
+	user       models.User
+	handle     []byte
+	passkeys   []models.Passkey
+	ceremonies map[string]models.WebAuthnCeremony
+	sessions   int
+}
+
+func newPasskeyDB(user models.User) *passkeyDB {
+	return &passkeyDB{user: user, ceremonies: map[string]models.WebAuthnCeremony{}}
+}
+
+// withUser runs handler as the user was signed in
+func (db *passkeyDB) withUser(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := db.user
+		handler(w, r.WithContext(context.WithValue(r.Context(), "user", &user)))
+	}
+}
+
+func (db *passkeyDB) SetWebAuthnID(userID int, handle []byte) ([]byte, error) {
+	if db.handle == nil {
+		db.handle = handle
+	}
+	return db.handle, nil
+}
+
+func (db *passkeyDB) GetUserByWebAuthnID(handle []byte) (*models.User, error) {
+	if db.handle == nil || !bytes.Equal(handle, db.handle) {
+		return nil, sql.ErrNoRows
+	}
+	user := db.user
+	return &user, nil
+}
+
+func (db *passkeyDB) CreatePasskey(p models.Passkey) (*models.Passkey, error) {
+	for _, existing := range db.passkeys {
+		if bytes.Equal(existing.CredentialID, p.CredentialID) {
+			return nil, sql.ErrNoRows
+		}
+	}
+	p.ID = len(db.passkeys) + 1
+	p.CreatedAt = time.Now()
+	db.passkeys = append(db.passkeys, p)
+	return &p, nil
+}
+
+func (db *passkeyDB) GetUserPasskeys(userID int) ([]models.Passkey, error) {
+	return append([]models.Passkey{}, db.passkeys...), nil
+}
+
+func (db *passkeyDB) GetPasskeyByCredentialID(credentialID []byte) (*models.Passkey, error) {
+	for _, p := range db.passkeys {
+		if bytes.Equal(p.CredentialID, credentialID) {
+			return &p, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (db *passkeyDB) UpdatePasskeyUsage(id int, signCount uint32, credential []byte) error {
+	for i := range db.passkeys {
+		p := &db.passkeys[i]
+		if p.ID == id && (p.SignCount < signCount || (p.SignCount == 0 && signCount == 0)) {
+			now := time.Now()
+			p.SignCount = signCount
+			p.Credential = credential
+			p.LastUsedAt = &now
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (db *passkeyDB) CreateWebAuthnCeremony(ceremony models.WebAuthnCeremony, ttl time.Duration) error {
+	db.ceremonies[ceremony.IDHash] = ceremony
+	return nil
+}
+
+func (db *passkeyDB) ConsumeWebAuthnCeremony(idHash string, kind string) (*models.WebAuthnCeremony, error) {
+	ceremony, ok := db.ceremonies[idHash]
+	if !ok || ceremony.Kind != kind {
+		return nil, sql.ErrNoRows
+	}
+	delete(db.ceremonies, idHash)
+	return &ceremony, nil
+}
+
+func (db *passkeyDB) CreateSession(session models.Session, tokenHash string, ttl time.Duration) (*models.Session, error) {
+	db.sessions++
+	session.ID = db.sessions
+	return &session, nil
+}
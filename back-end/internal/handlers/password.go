@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/email"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/ratelimit"
+	"subscription-tracker/internal/utils"
+	"subscription-tracker/internal/validation"
+)
+
+const (
+	passwordResetTokenTTL = 30 * time.Minute
+
+	// Reset emails that can be requested per address and per client
+	passwordResetsPerEmail = 3
+	passwordResetsPerIP    = 10
+)
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not an account uses the email, so accounts can't be enumerated.
+func ForgotPassword(db models.Database, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.ForgotPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		// Limits count every request, so they reveal nothing about the email
+		if ok, retryAfter := limiter.Allow("password-reset:ip:"+clientIP(r), passwordResetsPerIP, time.Hour); !ok {
+			writeRateLimited(w, r, retryAfter, "Too many password reset requests")
+			return
+		}
+		if ok, retryAfter := limiter.Allow("password-reset:email:"+strings.ToLower(req.Email), passwordResetsPerEmail, time.Hour); !ok {
+			writeRateLimited(w, r, retryAfter, "Too many password reset requests")
+			return
+		}
+
+		// Looked up after responding so timing doesn't tell accounts apart
+		go sendPasswordResetEmail(db, req.Email, problem.RequestID(r.Context()))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(models.MessageResponse{Message: "If an account uses this email, a password reset link has been sent to it"})
+	}
+}
+
+// ResetPassword sets a new password with a token from a reset link and signs
+// the user out everywhere
+func ResetPassword(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		passwordHash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		_, err = db.ResetPassword(utils.HashToken(req.Token), passwordHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Reset link is invalid, expired or already used")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		clearRefreshCookie(w)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.MessageResponse{Message: "Password has been reset, sign in with the new password"})
+	}
+}
+
+// Helper functions
+
+// sendPasswordResetEmail emails a reset link if an email/password account
+// uses the address. Google accounts have no password to reset.
+func sendPasswordResetEmail(db models.Database, address string, requestID string) {
+	user, err := db.GetUserByEmail(address)
+	if err != nil || user.ThirdParty != "" {
+		return
+	}
+
+	token, err := utils.GenerateSecureToken()
+	if err != nil {
+		log.Printf("[%s] Failed to generate password reset token: %v", requestID, err)
+		return
+	}
+
+	if err := db.CreatePasswordResetToken(user.ID, utils.HashToken(token), passwordResetTokenTTL); err != nil {
+		log.Printf("[%s] Failed to store password reset token: %v", requestID, err)
+		return
+	}
+
+	link := frontendURL() + "/reset-password?token=" + url.QueryEscape(token)
+	email.NewEmailService(email.ConfigFromEnv()).SendPasswordResetEmail(user.Email, user.Name, link)
+}
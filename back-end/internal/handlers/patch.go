@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/jsonpatch"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/validation"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// patchDocument is the JSON view of a subscription that patches are applied
+// to. Unknown members are rejected when it is decoded.
+type patchDocument struct {
+	Name            string  `json:"name"`
+	Category        string  `json:"category"`
+	Price           float64 `json:"price"`
+	BillingCycle    string  `json:"billingCycle"`
+	NextBillingDate string  `json:"nextBillingDate"`
+	IsActive        bool    `json:"isActive"`
+	Version         int     `json:"version"` // read-only, may be tested or restated
+}
+
+// PatchSubscription applies a JSON Merge Patch (RFC 7386) or JSON Patch
+// (RFC 6902) to a subscription and writes only the changed columns. The
+// version it is based on comes from If-Match, a version member of a merge
+// patch or a test of /version in a JSON Patch.
+func PatchSubscription(db models.Database, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "id must be an integer")
+			return
+		}
+
+		contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			contentType = ""
+		}
+		if contentType != mergePatchContentType && contentType != jsonPatchContentType && contentType != "application/json" {
+			w.Header().Set("Accept-Patch", mergePatchContentType+", "+jsonPatchContentType)
+			problem.Write(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "Content-Type must be "+mergePatchContentType+" or "+jsonPatchContentType)
+			return
+		}
+
+		current, err := db.GetSubscriptionByID(id)
+		if err != nil || current.UserID != user.ID {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Subscription not found")
+			return
+		}
+
+		var ops []jsonpatch.Operation
+		var merge map[string]interface{}
+		if contentType == jsonPatchContentType {
+			if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidPatch, "Body must be a JSON Patch array of operations")
+				return
+			}
+		} else {
+			var patch interface{}
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+				return
+			}
+			var ok bool
+			if merge, ok = patch.(map[string]interface{}); !ok {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidPatch, "Merge patch must be a JSON object")
+				return
+			}
+		}
+
+		bodyVersion, err := patchVersion(ops, merge)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidPatch, err.Error())
+			return
+		}
+
+		version, fromHeader, ok := expectedVersion(w, r, bodyVersion)
+		if !ok {
+			return
+		}
+		// Checked before applying, so a stale test of /version is a conflict
+		// rather than a failed patch
+		if version != 0 && version != current.Version {
+			writeVersionConflict(w, r, db, id, user.ID, fromHeader)
+			return
+		}
+
+		original := patchDocument{
+			Name:            current.Name,
+			Category:        current.Category,
+			Price:           current.Price,
+			BillingCycle:    current.BillingCycle,
+			NextBillingDate: current.NextBillingDate.Format("2006-01-02"),
+			IsActive:        current.IsActive,
+			Version:         current.Version,
+		}
+
+		doc, err := toGeneric(original)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		var patched interface{}
+		if contentType == jsonPatchContentType {
+			patched, err = jsonpatch.Apply(doc, ops)
+			if err != nil {
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidPatch, err.Error())
+				return
+			}
+		} else {
+			patched = jsonpatch.MergePatch(doc, merge)
+		}
+
+		updated, err := fromGeneric(patched)
+		if err != nil {
+			problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidPatch, "Patched subscription is invalid: "+err.Error())
+			return
+		}
+		if updated.Version != original.Version {
+			problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidPatch, "version is read-only")
+			return
+		}
+
+		req := models.CreateSubscriptionRequest{
+			Name:            updated.Name,
+			Category:        updated.Category,
+			Price:           updated.Price,
+			BillingCycle:    updated.BillingCycle,
+			NextBillingDate: updated.NextBillingDate,
+		}
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		patch := diffPatchDocuments(original, updated)
+		subscription, err := db.PatchSubscription(id, user.ID, version, patch)
+		if errors.Is(err, models.ErrVersionConflict) {
+			writeVersionConflict(w, r, db, id, user.ID, fromHeader)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Subscription not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if patch != (models.SubscriptionPatch{}) {
+			bus.Publish(events.SubscriptionUpdated, user.ID, subscription)
+		}
+
+		w.Header().Set("ETag", subscriptionETag(subscription.Version))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subscription)
+	}
+}
+
+// Helper functions
+
+// patchVersion returns the version a patch states it is based on: the version
+// member of a merge patch, or the value of a test or replace of /version in a
+// JSON Patch. It returns nil when the patch names no version.
+func patchVersion(ops []jsonpatch.Operation, merge map[string]interface{}) (*int, error) {
+	var raw json.RawMessage
+	if merge != nil {
+		value, ok := merge["version"]
+		if !ok {
+			return nil, nil
+		}
+		raw, _ = json.Marshal(value)
+	}
+	for _, op := range ops {
+		if op.Path == "/version" && (op.Op == "test" || op.Op == "replace") {
+			raw = op.Value
+			break
+		}
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil || version < 1 {
+		return nil, errors.New("version must be a positive integer")
+	}
+	return &version, nil
+}
+
+func toGeneric(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+func fromGeneric(doc interface{}) (patchDocument, error) {
+	var result patchDocument
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return result, err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&result)
+	return result, err
+}
+
+func diffPatchDocuments(original, updated patchDocument) models.SubscriptionPatch {
+	var patch models.SubscriptionPatch
+
+	if updated.Name != original.Name {
+		patch.Name = &updated.Name
+	}
+	if updated.Category != original.Category {
+		patch.Category = &updated.Category
+	}
+	if updated.Price != original.Price {
+		patch.Price = &updated.Price
+	}
+	if updated.BillingCycle != original.BillingCycle {
+		patch.BillingCycle = &updated.BillingCycle
+	}
+	if updated.NextBillingDate != original.NextBillingDate {
+		patch.NextBillingDate = &updated.NextBillingDate
+	}
+	if updated.IsActive != original.IsActive {
+		patch.IsActive = &updated.IsActive
+	}
+
+	return patch
+}
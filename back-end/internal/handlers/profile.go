@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/email"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/ratelimit"
+	"subscription-tracker/internal/utils"
+	"subscription-tracker/internal/validation"
+)
+
+const (
+	emailChangeTokenTTL = 24 * time.Hour
+
+	// Email change links a user can ask for per hour
+	emailChangesPerHour = 3
+)
+
+// UpdateProfile changes the user's display name
+func UpdateProfile(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.UpdateProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		updated, err := db.UpdateUserName(user.ID, req.Name)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+// ChangePassword sets a new password after checking the current one. Every
+// other session of the user is ended.
+func ChangePassword(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+		sessionID, _ := r.Context().Value("sessionID").(int)
+
+		var req models.ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		account, err := db.GetUserByEmail(user.Email)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		if account.ThirdParty == "google" {
+			problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "Google accounts sign in without a password")
+			return
+		}
+		if !utils.CheckPasswordHash(req.CurrentPassword, account.PasswordHash) {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid password")
+			return
+		}
+
+		passwordHash, err := utils.HashPassword(req.NewPassword)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		if err := db.ChangeUserPassword(user.ID, passwordHash, sessionID); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.MessageResponse{Message: "Password changed, other sessions have been signed out"})
+	}
+}
+
+// RequestEmailChange emails a confirmation link to the new address. The
+// account keeps its current email until the link is opened.
+func RequestEmailChange(db models.Database, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.ChangeEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		req.Email = strings.TrimSpace(req.Email)
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		account, err := db.GetUserByEmail(user.Email)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		// Google sign-in finds accounts by their Google email
+		if account.ThirdParty == "google" {
+			problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "The email of a Google account is managed by Google")
+			return
+		}
+		if !utils.CheckPasswordHash(req.Password, account.PasswordHash) {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid password")
+			return
+		}
+
+		if req.Email == account.Email {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "This is already the email of your account")
+			return
+		}
+		if existing, err := db.GetUserByEmail(req.Email); err == nil && existing.ID != user.ID {
+			problem.Write(w, r, http.StatusConflict, problem.CodeEmailTaken, "An account with this email already exists")
+			return
+		}
+
+		key := fmt.Sprintf("change-email:user:%d", user.ID)
+		if ok, retryAfter := limiter.Allow(key, emailChangesPerHour, time.Hour); !ok {
+			writeRateLimited(w, r, retryAfter, "Too many email change requests")
+			return
+		}
+
+		token, err := utils.GenerateEmailChangeJWT(user.ID, account.Email, req.Email, emailChangeTokenTTL)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		link := frontendURL() + "/confirm-email?token=" + url.QueryEscape(token)
+		go email.NewEmailService(email.ConfigFromEnv()).SendEmailChangeEmail(req.Email, account.Name, link)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(models.MessageResponse{Message: "Open the link sent to the new address to confirm the change"})
+	}
+}
+
+// ConfirmEmailChange switches the account to the address a change link was
+// sent to. Opening the link proves the address, so it is marked verified.
+func ConfirmEmailChange(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.ConfirmEmailChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		claims, err := utils.ValidatePurposeJWT(req.Token, utils.PurposeChangeEmail)
+		if err != nil || claims.NewEmail == "" {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Confirmation link is invalid or has expired")
+			return
+		}
+
+		// Fails when the email changed after the link was sent, which also
+		// makes each link single-use
+		user, err := db.ChangeUserEmail(claims.UserID, claims.Email, claims.NewEmail)
+		if errors.Is(err, models.ErrEmailTaken) {
+			problem.Write(w, r, http.StatusConflict, problem.CodeEmailTaken, "An account with this email already exists")
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Confirmation link is invalid or has expired")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
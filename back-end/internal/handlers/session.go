@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+
+	"github.com/gorilla/mux"
+)
+
+const maxUserAgentLength = 512
+
+// GetSessions lists the devices the user is signed in on
+func GetSessions(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+		currentID := r.Context().Value("sessionID").(int)
+
+		sessions, err := db.GetUserSessions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == currentID
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+// RevokeSession signs the user out on one device. Its access tokens are
+// rejected from the next request on.
+func RevokeSession(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "id must be an integer")
+			return
+		}
+
+		err = db.RevokeSession(id, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Session not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		if id == r.Context().Value("sessionID").(int) {
+			clearRefreshCookie(w)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RevokeOtherSessions signs the user out everywhere except the device making
+// the request
+func RevokeOtherSessions(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+		currentID := r.Context().Value("sessionID").(int)
+
+		revoked, err := db.RevokeOtherSessions(user.ID, currentID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.RevokeSessionsResponse{
+			Message: "Signed out of all other sessions",
+			Revoked: revoked,
+		})
+	}
+}
+
+// Helper functions
+func userAgent(r *http.Request) string {
+	agent := r.UserAgent()
+	if len(agent) > maxUserAgentLength {
+		agent = agent[:maxUserAgentLength]
+	}
+	return agent
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// trusted when TRUST_PROXY is set, since clients can send it themselves.
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
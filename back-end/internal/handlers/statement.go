@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/statement"
+)
+
+const maxStatementSize = 10 << 20 // 10 MB
+
+// AnalyzeStatement parses an uploaded bank statement and proposes recurring
+// charges as subscriptions. Nothing is saved: accepted candidates are created
+// by posting their subscription payload to CreateSubscription. The file is
+// sent as the "file" field of a multipart form or as the raw body. Query
+// parameters:
+//   - format: ofx, qfx, qif, camt053 or csv (detected from the content by default)
+//   - tolerance: relative amount deviation allowed between charges, default 0.1
+//   - minConfidence: lowest confidence to return, default 0.5
+//   - dateOrder: dmy or mdy for numeric CSV dates (detected from the file by default)
+func AnalyzeStatement(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+		query := r.URL.Query()
+
+		opts := statement.DetectOptions{
+			AmountTolerance: 0.1,
+			MinConfidence:   0.5,
+			Today:           time.Now().UTC(),
+		}
+		if value := query.Get("tolerance"); value != "" {
+			tolerance, err := strconv.ParseFloat(value, 64)
+			if err != nil || tolerance < 0 || tolerance > 1 {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "tolerance must be between 0 and 1")
+				return
+			}
+			opts.AmountTolerance = tolerance
+		}
+		if value := query.Get("minConfidence"); value != "" {
+			confidence, err := strconv.ParseFloat(value, 64)
+			if err != nil || confidence < 0 || confidence > 1 {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "minConfidence must be between 0 and 1")
+				return
+			}
+			opts.MinConfidence = confidence
+		}
+
+		dateOrder := strings.ToLower(query.Get("dateOrder"))
+		if dateOrder != "" && dateOrder != statement.DateOrderDayFirst && dateOrder != statement.DateOrderMonthFirst {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "dateOrder must be dmy or mdy")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxStatementSize)
+		var body io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Missing statement file")
+				return
+			}
+			defer file.Close()
+			body = file
+		}
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Failed to read statement")
+			return
+		}
+
+		format := strings.ToLower(query.Get("format"))
+		if format == "" {
+			format = statement.DetectFormat(data)
+		}
+
+		transactions, err := statement.Parse(format, data, dateOrder)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidFile, err.Error())
+			return
+		}
+
+		candidates := statement.DetectRecurring(transactions, opts)
+
+		existing, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		tracked := map[string]bool{}
+		for _, sub := range existing {
+			tracked[statement.NormalizeMerchant(sub.Name)] = true
+		}
+		for i := range candidates {
+			candidates[i].AlreadyTracked = tracked[candidates[i].NormalizedName]
+		}
+
+		response := models.StatementAnalysis{
+			Format:       format,
+			Transactions: len(transactions),
+			Candidates:   candidates,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
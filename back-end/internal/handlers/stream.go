@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/stream"
+	"subscription-tracker/internal/utils"
+)
+
+const (
+	streamRetry     = 5 * time.Second
+	streamKeepalive = 25 * time.Second
+	streamTokenTTL  = time.Minute
+)
+
+// IssueStreamToken returns a short-lived token that opens the event stream
+// as ?token=, for EventSource, which can't send an Authorization header.
+// Tokens only need to last until the stream is open, so clients fetch a new
+// one on every reconnect.
+func IssueStreamToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+		sessionID := r.Context().Value("sessionID").(int)
+
+		token, err := utils.GenerateStreamJWT(*user, sessionID, streamTokenTTL)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(models.StreamTokenResponse{
+			Token:     token,
+			ExpiresIn: int(streamTokenTTL.Seconds()),
+		})
+	}
+}
+
+// StreamEvents sends the user's subscription, stats and renewal changes as
+// Server-Sent Events until the client disconnects
+func StreamEvents(hub *stream.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		messages, closeStream, err := hub.Subscribe(user.ID)
+		if errors.Is(err, stream.ErrTooManyStreams) {
+			problem.Write(w, r, http.StatusTooManyRequests, problem.CodeLimitReached, fmt.Sprintf("At most %d event streams can be open at once", stream.MaxStreamsPerUser))
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeInternal, "Event streams are shutting down")
+			return
+		}
+		defer closeStream()
+
+		// The stream outlives the server's write timeout
+		controller := http.NewResponseController(w)
+		if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+			log.Printf("Failed to clear write deadline for event stream: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+		if err := controller.Flush(); err != nil {
+			return
+		}
+
+		keepalive := time.NewTicker(streamKeepalive)
+		defer keepalive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(message)
+				if err != nil {
+					log.Printf("Failed to encode stream message %s: %v", message.ID, err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", message.ID, message.Type, data)
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
 
 	"subscription-tracker/internal/cache"
+	"subscription-tracker/internal/catalog"
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/insights"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/validation"
 
 	"github.com/gorilla/mux"
 )
@@ -16,9 +23,15 @@ func GetSubscriptions(db models.Database, cacheService *cache.CacheService) http
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := r.Context().Value("user").(*models.User)
 
-		// Checking if subsciptions in cache
-		if cacheService != nil && cacheService.HasUserSubscriptionsCache(user.ID) {
-			cachedSubscriptions, err := cacheService.GetCachedUserSubscriptions(user.ID)
+		version, versioned := userDataVersion(cacheService, user.ID)
+		if versioned && notModified(w, r, userDataETag(user.ID, version, "subscriptions"), version) {
+			return
+		}
+
+		// Checking if subsciptions in cache. Entries are stamped with the data
+		// version, so one cached from a read that raced a write is skipped.
+		if versioned && cacheService.HasUserSubscriptionsCache(user.ID) {
+			cachedSubscriptions, err := cacheService.GetCachedUserSubscriptions(user.ID, version)
 			if err == nil {
 				w.Header().Set("X-Cache", "HIT")
 				w.Header().Set("Content-Type", "application/json")
@@ -29,14 +42,14 @@ func GetSubscriptions(db models.Database, cacheService *cache.CacheService) http
 
 		subscriptions, err := db.GetUserSubscriptions(user.ID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
 		// Cache the result for future requests
-		if cacheService != nil {
+		if versioned {
 			go func() {
-				err := cacheService.CacheUserSubscriptions(user.ID, subscriptions)
+				err := cacheService.CacheUserSubscriptions(user.ID, version, subscriptions)
 				if err != nil {
 					log.Printf("Failed to cache subscriptions: %v", err)
 				}
@@ -48,42 +61,73 @@ func GetSubscriptions(db models.Database, cacheService *cache.CacheService) http
 	}
 }
 
-func CreateSubscription(db models.Database, cacheService *cache.CacheService) http.HandlerFunc {
+func CreateSubscription(db models.Database, serviceCatalog *catalog.Catalog, bus *events.Bus) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.CreateSubscriptionRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if err := applyCatalogPlan(serviceCatalog, &req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
 			return
 		}
 
 		user := r.Context().Value("user").(*models.User)
 
+		// Look for near-duplicates before the new subscription joins the list
+		existing, err := db.GetUserSubscriptions(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
 		subscription, err := db.CreateSubscription(req, user.ID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		//		cacheService.InvalidateUserSubscriptionsAndStatsCache(user.ID)
+		bus.Publish(events.SubscriptionCreated, user.ID, subscription)
+
+		response := models.CreateSubscriptionResponse{
+			Subscription: *subscription,
+			Warnings:     insights.FindSimilar(*subscription, existing, catalogResolver(serviceCatalog)),
+		}
 
+		w.Header().Set("ETag", subscriptionETag(subscription.Version))
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(subscription)
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
+// GetSubscription returns a subscription with its version as ETag, which
+// updates and deletes send back in If-Match
 func GetSubscription(db models.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "id must be an integer")
 			return
 		}
 
 		subscription, err := db.GetSubscriptionByID(id)
-		if err != nil {
-			http.Error(w, "Subscription not found", http.StatusNotFound)
+		if err != nil || subscription.UserID != user.ID {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Subscription not found")
+			return
+		}
+
+		if notModified(w, r, subscriptionETag(subscription.Version), subscription.UpdatedAt) {
 			return
 		}
 
@@ -92,61 +136,119 @@ func GetSubscription(db models.Database) http.HandlerFunc {
 	}
 }
 
-func UpdateSubscription(db models.Database, cacheService *cache.CacheService) http.HandlerFunc {
+// UpdateSubscription replaces a subscription. The version it is based on must
+// be sent in If-Match or as the version field.
+func UpdateSubscription(db models.Database, serviceCatalog *catalog.Catalog, bus *events.Bus) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "id must be an integer")
 			return
 		}
 
 		var req models.CreateSubscriptionRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if err := applyCatalogPlan(serviceCatalog, &req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
 			return
 		}
 
-		subscription, err := db.UpdateSubscription(id, req)
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		version, fromHeader, ok := expectedVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
+		subscription, err := db.UpdateSubscription(id, user.ID, version, req)
+		if errors.Is(err, models.ErrVersionConflict) {
+			writeVersionConflict(w, r, db, id, user.ID, fromHeader)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Subscription not found")
+			return
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		//		cacheService.InvalidateUserSubscriptionsAndStatsCache(id)
+		bus.Publish(events.SubscriptionUpdated, subscription.UserID, subscription)
 
+		w.Header().Set("ETag", subscriptionETag(subscription.Version))
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(subscription)
 	}
 }
 
-func DeleteSubscription(db models.Database, cacheService *cache.CacheService) http.HandlerFunc {
+// DeleteSubscription deletes a subscription. The version it is based on must
+// be sent in If-Match or as the version query parameter.
+func DeleteSubscription(db models.Database, bus *events.Bus) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := r.Context().Value("user").(*models.User)
 
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "id must be an integer")
+			return
+		}
+
+		var queryVersion *int
+		if value := r.URL.Query().Get("version"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "version must be a positive integer")
+				return
+			}
+			queryVersion = &parsed
+		}
+
+		version, fromHeader, ok := expectedVersion(w, r, queryVersion)
+		if !ok {
 			return
 		}
 
-		err = db.DeleteSubscription(id, user.ID)
+		err = db.DeleteSubscription(id, user.ID, version)
+		if errors.Is(err, models.ErrVersionConflict) {
+			writeVersionConflict(w, r, db, id, user.ID, fromHeader)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Subscription not found")
+			return
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		//		cacheService.InvalidateUserSubscriptionsAndStatsCache(id)
+		bus.Publish(events.SubscriptionDeleted, user.ID, models.SubscriptionDeletedEvent{ID: id})
 
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func GetUserSubscriptionsStats(db models.Database) http.HandlerFunc {
+func GetUserSubscriptionsStats(db models.Database, cacheService *cache.CacheService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := r.Context().Value("user").(*models.User)
 
+		version, versioned := userDataVersion(cacheService, user.ID)
+		if versioned && notModified(w, r, userDataETag(user.ID, version, "stats"), version) {
+			return
+		}
+
 		// Checking if subsciptions in cache
 		// if cacheService != nil && cacheService.HasUserSubscriptionsCache(user.ID) {
 		// 	cachedSubscriptions, err := cacheService.GetCachedUserSubscriptions(user.ID)
@@ -159,9 +261,8 @@ func GetUserSubscriptionsStats(db models.Database) http.HandlerFunc {
 		// }
 
 		stats, err := db.GetUserSubscriptionsStats(user.ID)
-		println(err)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/ratelimit"
+	"subscription-tracker/internal/totp"
+	"subscription-tracker/internal/utils"
+	"subscription-tracker/internal/validation"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	totpIssuer        = "Subscription Tracker"
+	recoveryCodeCount = 10
+
+	loginChallengeTTL = 5 * time.Minute
+
+	// Codes that can be tried against one account's sign-in challenges
+	loginChallengeAttempts = 5
+	loginChallengeWindow   = 15 * time.Minute
+)
+
+// GetTwoFactorStatus tells whether two-factor authentication protects the
+// user's sign-ins
+func GetTwoFactorStatus(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		status := models.TwoFactorStatus{}
+		userTOTP, err := db.GetTOTP(user.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			problem.Internal(w, r, err)
+			return
+		}
+		if userTOTP != nil && userTOTP.EnabledAt != nil {
+			status.Enabled = true
+			status.RecoveryCodesLeft = userTOTP.RecoveryCodesLeft
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// EnrollTOTP creates a new authenticator secret. It protects nothing until
+// a code from it is confirmed.
+func EnrollTOTP(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		// Never replaces the secret of an enabled authenticator
+		err = db.SaveTOTPSecret(user.ID, secret)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusConflict, problem.CodeTwoFactorEnabled, "Disable two-factor authentication before enrolling a new authenticator")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		response := models.TOTPEnrollment{
+			Secret: secret,
+			URI:    totp.URI(secret, totpIssuer, user.Email),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// ConfirmTOTP turns on two-factor authentication with a code from the
+// enrolled authenticator and returns the user's recovery codes. They are
+// shown this once.
+func ConfirmTOTP(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.TOTPCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		userTOTP, err := db.GetTOTP(user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Enroll an authenticator before confirming it")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if userTOTP.EnabledAt != nil {
+			problem.Write(w, r, http.StatusConflict, problem.CodeTwoFactorEnabled, "Two-factor authentication is already enabled")
+			return
+		}
+
+		step, ok := totp.Validate(userTOTP.Secret, req.Code, time.Now())
+		if !ok {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidCode, "Invalid authentication code")
+			return
+		}
+
+		codes, codeHashes, err := generateRecoveryCodes()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		err = db.EnableTOTP(user.ID, step, codeHashes)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusConflict, problem.CodeTwoFactorEnabled, "Two-factor authentication is already enabled")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.RecoveryCodesResponse{
+			Message:       "Two-factor authentication enabled. Store the recovery codes somewhere safe, each one works once.",
+			RecoveryCodes: codes,
+		})
+	}
+}
+
+// DisableTOTP turns off two-factor authentication after confirming the
+// user's identity like account deletion does
+func DisableTOTP(db models.Database, googleOauthConfig *oauth2.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.DisableTwoFactorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if !reauthenticate(w, r, db, googleOauthConfig, *user, req.Password, req.Code) {
+			return
+		}
+
+		if err := db.DisableTOTP(user.ID); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes. It takes
+// a current authenticator or recovery code.
+func RegenerateRecoveryCodes(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.TOTPCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		enabled, err := twoFactorEnabled(db, user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if !enabled {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Two-factor authentication is not enabled")
+			return
+		}
+
+		ok, err := checkSecondFactor(db, user.ID, req.Code)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if !ok {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidCode, "Invalid authentication code")
+			return
+		}
+
+		codes, codeHashes, err := generateRecoveryCodes()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		if err := db.ReplaceRecoveryCodes(user.ID, codeHashes); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.RecoveryCodesResponse{
+			Message:       "Recovery codes replaced. Codes from before no longer work.",
+			RecoveryCodes: codes,
+		})
+	}
+}
+
+// VerifyLoginChallenge finishes a sign-in that needs a second factor. It
+// answers like Login once the code is accepted.
+func VerifyLoginChallenge(db models.Database, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.LoginChallengeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		claims, err := utils.ValidatePurposeJWT(req.ChallengeToken, utils.PurposeLoginChallenge)
+		if err != nil {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Sign-in has expired, sign in again")
+			return
+		}
+
+		// Counted per account, as every challenge of an account shares its codes
+		key := fmt.Sprintf("login-2fa:user:%d", claims.UserID)
+		if ok, retryAfter := limiter.Allow(key, loginChallengeAttempts, loginChallengeWindow); !ok {
+			writeRateLimited(w, r, retryAfter, "Too many authentication codes were tried")
+			return
+		}
+
+		user, err := db.GetUserByEmail(claims.Email)
+		if err != nil || user.ID != claims.UserID {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Sign-in has expired, sign in again")
+			return
+		}
+
+		ok, err := checkSecondFactor(db, user.ID, req.Code)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if !ok {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCode, "Invalid authentication code")
+			return
+		}
+
+		// Start a session and generate its tokens
+		token, err := startSession(w, r, db, *user)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		response := models.AuthResponse{
+			Message: "Login Successful",
+			Token:   token,
+			User:    *user,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// Helper functions
+
+func twoFactorEnabled(db models.Database, userID int) (bool, error) {
+	userTOTP, err := db.GetTOTP(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return userTOTP.EnabledAt != nil, nil
+}
+
+// checkSecondFactor accepts a code from the user's authenticator or one of
+// their recovery codes, and uses it up. Authenticator codes can't be used
+// twice either.
+func checkSecondFactor(db models.Database, userID int, code string) (bool, error) {
+	userTOTP, err := db.GetTOTP(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if userTOTP.EnabledAt == nil {
+		return false, nil
+	}
+
+	if step, ok := totp.Validate(userTOTP.Secret, code, time.Now()); ok {
+		err = db.UseTOTPStep(userID, step)
+	} else {
+		err = db.UseRecoveryCode(userID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// generateRecoveryCodes returns a new set of recovery codes and the hashes
+// to store for them
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	codeHashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code
+		codeHashes[i] = utils.HashToken(utils.NormalizeRecoveryCode(code))
+	}
+
+	return codes, codeHashes, nil
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/totp"
+)
+
+// TestCheckSecondFactorReplay uses up authenticator codes, so neither the
+// same code nor one from an earlier step of the window is accepted again
+func TestCheckSecondFactorReplay(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabledAt := time.Now()
+	db := &totpDB{totp: models.TOTP{UserID: 1, Secret: secret, EnabledAt: &enabledAt}}
+
+	code := func(step int64) string {
+		value, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	current := totp.Step(time.Now())
+
+	steps := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"current code", code(current), true},
+		{"same code again", code(current), false},
+		{"earlier code in the window", code(current - 1), false},
+		{"later code in the window", code(current + 1), true},
+		{"wrong code", "000000", false},
+	}
+
+	for _, step := range steps {
+		ok, err := checkSecondFactor(db, 1, step.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != step.want {
+			t.Errorf("%s: accepted %v, want %v", step.name, ok, step.want)
+		}
+	}
+}
+
+// totpDB keeps one user's authenticator in memory, mirroring the
+// last_used_step check of UseTOTPStep. Other methods of models.Database are
+// not implemented.
+type totpDB struct {
+	models.Database
+
+	totp models.TOTP
+}
+
+func (db *totpDB) GetTOTP(userID int) (*models.TOTP, error) {
+	if userID != db.totp.UserID {
+		return nil, sql.ErrNoRows
+	}
+	userTOTP := db.totp
+	return &userTOTP, nil
+}
+
+func (db *totpDB) UseTOTPStep(userID int, step int64) error {
+	if userID != db.totp.UserID || db.totp.LastUsedStep >= step {
+		return sql.ErrNoRows
+	}
+	db.totp.LastUsedStep = step
+	return nil
+}
+
+func (db *totpDB) UseRecoveryCode(userID int, codeHash string) error {
+	return sql.ErrNoRows
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/email"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/ratelimit"
+	"subscription-tracker/internal/utils"
+	"subscription-tracker/internal/validation"
+)
+
+const (
+	verificationTokenTTL = 24 * time.Hour
+
+	// Verification emails a user can ask for
+	verificationResendsPerMinute = 1
+	verificationResendsPerDay    = 5
+)
+
+// VerifyEmail confirms the address a verification link was sent to
+func VerifyEmail(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validation.Struct(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		claims, err := utils.ValidatePurposeJWT(req.Token, utils.PurposeVerifyEmail)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Verification link is invalid or has expired")
+			return
+		}
+
+		// Fails when the account's email changed after the link was sent
+		err = db.VerifyUserEmail(claims.UserID, claims.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Verification link is invalid or has expired")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.MessageResponse{Message: "Email verified"})
+	}
+}
+
+// ResendVerificationEmail sends a new verification link to the user, at most
+// once a minute and five times a day
+func ResendVerificationEmail(limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		if user.EmailVerified {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(models.MessageResponse{Message: "Email address is already verified"})
+			return
+		}
+
+		key := fmt.Sprintf("verify-email:user:%d", user.ID)
+		if ok, retryAfter := limiter.Allow(key+":minute", verificationResendsPerMinute, time.Minute); !ok {
+			writeRateLimited(w, r, retryAfter, "A verification email was just sent. Try again shortly.")
+			return
+		}
+		if ok, retryAfter := limiter.Allow(key+":day", verificationResendsPerDay, 24*time.Hour); !ok {
+			writeRateLimited(w, r, retryAfter, "Too many verification emails were requested today")
+			return
+		}
+
+		if err := sendVerificationEmail(*user); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(models.MessageResponse{Message: "Verification email sent"})
+	}
+}
+
+// Helper functions
+
+// sendVerificationEmail emails the user a link proving they control their
+// address. Delivery happens in the background.
+func sendVerificationEmail(user models.User) error {
+	token, err := utils.GeneratePurposeJWT(user.ID, user.Email, utils.PurposeVerifyEmail, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendURL() + "/verify-email?token=" + url.QueryEscape(token)
+	go email.NewEmailService(email.ConfigFromEnv()).SendVerificationEmail(user.Email, user.Name, link)
+
+	return nil
+}
+
+func frontendURL() string {
+	if baseURL := os.Getenv("FRONTEND_URL"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return "http://localhost:3000"
+}
+
+func writeRateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, detail string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, detail)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/utils"
+	"subscription-tracker/internal/validation"
+	"subscription-tracker/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxWebhooksPerUser     = 10
+	defaultDeliveriesLimit = 50
+)
+
+func GetWebhooks(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		webhooks, err := db.GetUserWebhooks(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(webhooks)
+	}
+}
+
+// CreateWebhook registers an endpoint and returns its signing secret. The
+// secret is only shown in this response.
+func CreateWebhook(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		var req models.WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validateWebhookRequest(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		existing, err := db.GetUserWebhooks(user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if len(existing) >= maxWebhooksPerUser {
+			problem.Write(w, r, http.StatusConflict, problem.CodeLimitReached, "You can register at most 10 webhooks")
+			return
+		}
+
+		secret, err := utils.GenerateSecureToken()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		created, err := db.CreateWebhook(models.Webhook{
+			UserID:   user.ID,
+			URL:      req.URL,
+			Events:   uniqueStrings(req.Events),
+			Secret:   "whsec_" + secret,
+			IsActive: req.IsActive == nil || *req.IsActive,
+		})
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.CreateWebhookResponse{
+			Webhook: *created,
+			Secret:  created.Secret,
+		})
+	}
+}
+
+func GetWebhook(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		id, ok := webhookID(w, r)
+		if !ok {
+			return
+		}
+
+		found, err := db.GetWebhook(id, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Webhook not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(found)
+	}
+}
+
+// UpdateWebhook changes the URL, events or active flag. The secret is kept.
+func UpdateWebhook(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		id, ok := webhookID(w, r)
+		if !ok {
+			return
+		}
+
+		var req models.WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Request body is not valid JSON")
+			return
+		}
+
+		if errs := validateWebhookRequest(req); len(errs) > 0 {
+			problem.Validation(w, r, errs)
+			return
+		}
+
+		updated, err := db.UpdateWebhook(models.Webhook{
+			ID:       id,
+			UserID:   user.ID,
+			URL:      req.URL,
+			Events:   uniqueStrings(req.Events),
+			IsActive: req.IsActive == nil || *req.IsActive,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Webhook not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+func DeleteWebhook(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		id, ok := webhookID(w, r)
+		if !ok {
+			return
+		}
+
+		err := db.DeleteWebhook(id, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Webhook not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first
+func GetWebhookDeliveries(db models.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		id, ok := webhookID(w, r)
+		if !ok {
+			return
+		}
+
+		limit := defaultDeliveriesLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 200 {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 200")
+				return
+			}
+			limit = parsed
+		}
+
+		if _, err := db.GetWebhook(id, user.ID); errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Webhook not found")
+			return
+		} else if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		deliveries, err := db.GetWebhookDeliveries(id, user.ID, limit)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deliveries)
+	}
+}
+
+// ReplayWebhookDelivery queues a finished delivery to be sent again with the
+// original payload
+func ReplayWebhookDelivery(db models.Database, dispatcher *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(*models.User)
+
+		id, ok := webhookID(w, r)
+		if !ok {
+			return
+		}
+		deliveryID, err := strconv.Atoi(mux.Vars(r)["deliveryId"])
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "deliveryId must be an integer")
+			return
+		}
+
+		delivery, err := db.ReplayWebhookDelivery(deliveryID, id, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Delivery not found or still pending")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		if dispatcher != nil {
+			dispatcher.Wake()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(delivery)
+	}
+}
+
+// Helper functions
+func webhookID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "id must be an integer")
+		return 0, false
+	}
+	return id, true
+}
+
+func validateWebhookRequest(req models.WebhookRequest) []models.FieldError {
+	if errs := validation.Struct(req); len(errs) > 0 {
+		return errs
+	}
+
+	// Plain HTTP is only allowed outside production, for local receivers
+	parsed, err := url.Parse(req.URL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && (parsed.Scheme != "http" || os.Getenv("ENV") == "production")) {
+		return []models.FieldError{{Field: "url", Code: "https", Message: "must be an https URL"}}
+	}
+
+	return nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,135 @@
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/billing"
+	"subscription-tracker/internal/models"
+)
+
+// ReminderLeadDays matches the window used by GetUpcomingSubscriptions, so
+// calendar alarms fire when the reminder email would be sent
+const ReminderLeadDays = 3
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405Z"
+	maxLineOctets  = 75
+)
+
+// BuildFeed renders an RFC 5545 calendar with one recurring all-day event per
+// active subscription
+func BuildFeed(calendarName string, subscriptions []models.Subscription, now time.Time) []byte {
+	var buf bytes.Buffer
+
+	writeLine(&buf, "BEGIN:VCALENDAR")
+	writeLine(&buf, "VERSION:2.0")
+	writeLine(&buf, "PRODID:-//Subscription Tracker//Renewals//EN")
+	writeLine(&buf, "CALSCALE:GREGORIAN")
+	writeLine(&buf, "METHOD:PUBLISH")
+	writeLine(&buf, "X-WR-CALNAME:"+escapeText(calendarName))
+
+	for _, sub := range subscriptions {
+		if !sub.IsActive {
+			continue
+		}
+
+		start := billing.Day(sub.NextBillingDate)
+		amount := strconv.FormatFloat(sub.Price, 'f', 2, 64)
+
+		writeLine(&buf, "BEGIN:VEVENT")
+		writeLine(&buf, fmt.Sprintf("UID:subscription-%d@subscription-tracker", sub.ID))
+		writeLine(&buf, "DTSTAMP:"+now.UTC().Format(dateTimeLayout))
+		writeLine(&buf, "LAST-MODIFIED:"+sub.UpdatedAt.UTC().Format(dateTimeLayout))
+		writeLine(&buf, "DTSTART;VALUE=DATE:"+start.Format(dateLayout))
+		writeLine(&buf, "DTEND;VALUE=DATE:"+start.AddDate(0, 0, 1).Format(dateLayout))
+		writeLine(&buf, "RRULE:"+RecurrenceRule(start, sub.BillingCycle))
+		writeLine(&buf, "SUMMARY:"+escapeText(fmt.Sprintf("%s renewal ($%s)", sub.Name, amount)))
+		writeLine(&buf, "DESCRIPTION:"+escapeText(fmt.Sprintf("%s is billed %s.\nAmount: $%s\nCategory: %s", sub.Name, sub.BillingCycle, amount, sub.Category)))
+		writeLine(&buf, "CATEGORIES:"+escapeText(sub.Category))
+		writeLine(&buf, "TRANSP:TRANSPARENT")
+
+		writeLine(&buf, "BEGIN:VALARM")
+		writeLine(&buf, "ACTION:DISPLAY")
+		writeLine(&buf, "DESCRIPTION:"+escapeText(fmt.Sprintf("%s renews in %d days", sub.Name, ReminderLeadDays)))
+		writeLine(&buf, fmt.Sprintf("TRIGGER:-P%dD", ReminderLeadDays))
+		writeLine(&buf, "END:VALARM")
+
+		writeLine(&buf, "END:VEVENT")
+	}
+
+	writeLine(&buf, "END:VCALENDAR")
+
+	return buf.Bytes()
+}
+
+// RecurrenceRule returns the RRULE value for a billing cycle starting on start.
+// A plain monthly or yearly rule skips months that lack the start day, so days
+// after the 28th pick the last available day up to the start day instead,
+// matching billing.AddCycles.
+func RecurrenceRule(start time.Time, cycle string) string {
+	switch cycle {
+	case billing.CycleWeekly:
+		return "FREQ=WEEKLY"
+	case billing.CycleYearly:
+		if start.Day() > 28 {
+			return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYMONTHDAY=%s;BYSETPOS=-1", int(start.Month()), monthDaysFrom28(start.Day()))
+		}
+		return "FREQ=YEARLY"
+	default:
+		if start.Day() > 28 {
+			return fmt.Sprintf("FREQ=MONTHLY;BYMONTHDAY=%s;BYSETPOS=-1", monthDaysFrom28(start.Day()))
+		}
+		return "FREQ=MONTHLY"
+	}
+}
+
+// Helper functions
+func monthDaysFrom28(day int) string {
+	days := []string{}
+	for d := 28; d <= day; d++ {
+		days = append(days, strconv.Itoa(d))
+	}
+	return strings.Join(days, ",")
+}
+
+func escapeText(value string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return replacer.Replace(value)
+}
+
+// writeLine folds content lines longer than 75 octets without splitting UTF-8
+// sequences and terminates them with CRLF
+func writeLine(buf *bytes.Buffer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+
+		// Continuation lines start with a space that counts towards the limit
+		limit = maxLineOctets - 1
+	}
+
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,105 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/redis"
+)
+
+const (
+	// defaultTTL is how long a finished response is replayed, unless
+	// IDEMPOTENCY_KEY_TTL sets another number of seconds
+	defaultTTL = 24 * time.Hour
+
+	// pendingLease bounds how long a key stays locked by a request that never
+	// finished, e.g. because the server restarted while handling it
+	pendingLease = time.Minute
+)
+
+// Store keeps idempotency records in Redis when it is available and in the
+// database otherwise
+type Store struct {
+	redisClient *redis.RedisClient
+	db          models.Database
+	ttl         time.Duration
+}
+
+func NewStore(redisClient *redis.RedisClient, db models.Database) *Store {
+	ttl := defaultTTL
+	if value, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_KEY_TTL")); err == nil && value > 0 {
+		ttl = time.Duration(value) * time.Second
+	}
+
+	if redisClient != nil {
+		log.Printf("Storing idempotency keys in Redis for %s", ttl)
+	} else {
+		log.Printf("Storing idempotency keys in the database for %s", ttl)
+	}
+
+	return &Store{
+		redisClient: redisClient,
+		db:          db,
+		ttl:         ttl,
+	}
+}
+
+// Fingerprint identifies a request so a key reused for a different one can
+// be rejected. target is the request URI, so the query string counts too.
+func Fingerprint(method, target string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + target + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Reserve locks key for a new request. If the key is already taken it returns
+// the existing record instead, which is still pending while the first
+// request is being handled.
+func (s *Store) Reserve(userID int, key, fingerprint string) (*models.IdempotencyRecord, error) {
+	record := models.IdempotencyRecord{UserID: userID, Key: key, Fingerprint: fingerprint}
+
+	if s.redisClient != nil {
+		cacheKey := s.redisClient.GetIdempotencyKey(userID, key)
+		reserved, err := s.redisClient.SetNX(cacheKey, record, pendingLease)
+		if err != nil || reserved {
+			return nil, err
+		}
+
+		var existing models.IdempotencyRecord
+		if err := s.redisClient.Get(cacheKey, &existing); err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+
+	reserved, err := s.db.ReserveIdempotencyKey(record, pendingLease)
+	if err != nil || reserved {
+		return nil, err
+	}
+	return s.db.GetIdempotencyKey(userID, key)
+}
+
+// Complete stores the response of the request holding the key
+func (s *Store) Complete(record models.IdempotencyRecord) error {
+	record.Completed = true
+
+	if s.redisClient != nil {
+		return s.redisClient.Set(s.redisClient.GetIdempotencyKey(record.UserID, record.Key), record, s.ttl)
+	}
+	return s.db.CompleteIdempotencyKey(record, s.ttl)
+}
+
+// Release frees the key so the request can be retried, used when it failed
+// with a server error
+func (s *Store) Release(userID int, key string) error {
+	if s.redisClient != nil {
+		return s.redisClient.Delete(s.redisClient.GetIdempotencyKey(userID, key))
+	}
+	return s.db.DeleteIdempotencyKey(userID, key)
+}
@@ -0,0 +1,237 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"subscription-tracker/internal/models"
+)
+
+// Fields lists the subscription fields that can be imported, in export order
+var Fields = []string{"name", "category", "price", "billingCycle", "nextBillingDate", "isActive"}
+
+// formulaPrefixes start cells that spreadsheets evaluate as formulas
+const formulaPrefixes = "=+-@\t\r"
+
+// Record is one imported row keyed by subscription field
+type Record struct {
+	Row    int
+	Values map[string]string
+}
+
+// ParseMapping parses a "field:Column,field:Column" list into a map of
+// subscription field to source column
+func ParseMapping(value string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if strings.TrimSpace(value) == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		field, column, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid mapping %q, expected field:column", pair)
+		}
+
+		field = canonicalField(field)
+		if field == "" {
+			return nil, fmt.Errorf("unknown field in mapping %q", pair)
+		}
+
+		mapping[field] = strings.TrimSpace(column)
+	}
+
+	return mapping, nil
+}
+
+// ParseCSV reads a CSV document with a header row. Columns are matched to
+// fields through mapping first and then by name, ignoring case and separators.
+func ParseCSV(r io.Reader, mapping map[string]string) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []Record{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[normalize(column)] = i
+	}
+
+	indexes := map[string]int{}
+	for _, field := range Fields {
+		source := field
+		if column, ok := mapping[field]; ok {
+			source = column
+		}
+
+		if i, ok := columns[normalize(source)]; ok {
+			indexes[field] = i
+		} else if _, mapped := mapping[field]; mapped {
+			return nil, fmt.Errorf("mapped column %q not found", source)
+		}
+	}
+
+	records := []Record{}
+	for row := 2; ; row++ {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row %d: %v", row, err)
+		}
+
+		record := Record{Row: row, Values: map[string]string{}}
+		for field, i := range indexes {
+			if i < len(line) {
+				record.Values[field] = UnescapeCell(strings.TrimSpace(line[i]))
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// ParseJSON reads a JSON array of objects, matching keys to fields the same
+// way ParseCSV matches columns. A mapped key that none of the objects has is
+// an error, like a mapped column missing from the CSV header.
+func ParseJSON(r io.Reader, mapping map[string]string) ([]Record, error) {
+	var items []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("invalid JSON, expected an array of objects: %v", err)
+	}
+
+	found := map[string]bool{}
+	records := make([]Record, 0, len(items))
+	for i, item := range items {
+		keys := map[string]interface{}{}
+		for key, value := range item {
+			keys[normalize(key)] = value
+		}
+
+		record := Record{Row: i + 1, Values: map[string]string{}}
+		for _, field := range Fields {
+			source := field
+			if column, ok := mapping[field]; ok {
+				source = column
+			}
+
+			value, ok := keys[normalize(source)]
+			if ok {
+				found[field] = true
+			}
+			if !ok || value == nil {
+				continue
+			}
+
+			switch v := value.(type) {
+			case string:
+				record.Values[field] = strings.TrimSpace(v)
+			case float64:
+				record.Values[field] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record.Values[field] = fmt.Sprint(v)
+			}
+		}
+		records = append(records, record)
+	}
+
+	if len(items) > 0 {
+		for _, field := range Fields {
+			if column, mapped := mapping[field]; mapped && !found[field] {
+				return nil, fmt.Errorf("mapped key %q not found", column)
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// ToRequest converts a record to a subscription request and its isActive
+// value, which is nil when the record leaves it empty. It returns the fields
+// that could not be converted.
+func (rec Record) ToRequest() (models.CreateSubscriptionRequest, *bool, []string) {
+	var errs []string
+
+	req := models.CreateSubscriptionRequest{
+		Name:            rec.Values["name"],
+		Category:        rec.Values["category"],
+		BillingCycle:    strings.ToLower(rec.Values["billingCycle"]),
+		NextBillingDate: rec.Values["nextBillingDate"],
+	}
+
+	if value := rec.Values["price"]; value != "" {
+		price, err := strconv.ParseFloat(strings.TrimLeft(value, "$€£¥₮ "), 64)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("price %q is not a number", value))
+		}
+		req.Price = price
+	}
+
+	var active *bool
+	if value := rec.Values["isActive"]; value != "" {
+		parsed, err := strconv.ParseBool(strings.ToLower(value))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("isActive %q is not true or false", value))
+		}
+		active = &parsed
+	}
+
+	return req, active, errs
+}
+
+// EscapeCell prefixes a CSV cell that a spreadsheet would run as a formula
+// with a quote, so it is shown as text. Cells that already look escaped get
+// another quote, so UnescapeCell gives them back unchanged.
+func EscapeCell(value string) string {
+	if (value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0]))) || isEscaped(value) {
+		return "'" + value
+	}
+	return value
+}
+
+// UnescapeCell reverses EscapeCell, so exported files import unchanged
+func UnescapeCell(value string) string {
+	if isEscaped(value) {
+		return value[1:]
+	}
+	return value
+}
+
+// Helper functions
+func isEscaped(value string) bool {
+	return len(value) > 1 && value[0] == '\'' && (strings.ContainsRune(formulaPrefixes, rune(value[1])) || isEscaped(value[1:]))
+}
+
+func canonicalField(value string) string {
+	key := normalize(value)
+	for _, field := range Fields {
+		if normalize(field) == key {
+			return field
+		}
+	}
+	return ""
+}
+
+func normalize(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,289 @@
+package insights
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"subscription-tracker/internal/billing"
+	"subscription-tracker/internal/models"
+)
+
+// Resolver maps a subscription name to a catalog service
+type Resolver interface {
+	Resolve(name string) (models.CatalogService, bool)
+}
+
+// Finding kinds
+const (
+	KindExact   = "exact"
+	KindFuzzy   = "fuzzy"
+	KindBundle  = "bundle"
+	KindOverlap = "overlap"
+)
+
+// Names at least this similar are treated as the same service
+const nameSimilarityThreshold = 0.85
+
+// Words describing the plan rather than the service
+var planWords = map[string]bool{
+	"plus": true, "premium": true, "pro": true, "family": true, "basic": true,
+	"standard": true, "individual": true, "duo": true, "student": true, "annual": true,
+	"monthly": true, "yearly": true, "subscription": true, "membership": true, "plan": true,
+	"account": true,
+}
+
+// FindDuplicates flags active subscriptions that look like the same service
+// paid twice, standalone services already included in a subscribed bundle, and
+// categories with several services that may overlap. The resolver is optional.
+func FindDuplicates(subscriptions []models.Subscription, resolver Resolver) models.DuplicateReport {
+	var active []models.Subscription
+	for _, sub := range subscriptions {
+		if sub.IsActive {
+			active = append(active, sub)
+		}
+	}
+
+	findings := []models.DuplicateFinding{}
+
+	// Exact duplicates are grouped so that three copies make one finding
+	exactGroups := map[string][]models.Subscription{}
+	for _, sub := range active {
+		key := fmt.Sprintf("%s|%.2f|%s", nameKey(sub.Name), sub.Price, sub.BillingCycle)
+		exactGroups[key] = append(exactGroups[key], sub)
+	}
+	exactGroup := map[int]string{}
+	for key, group := range exactGroups {
+		if len(group) < 2 {
+			continue
+		}
+		for _, sub := range group {
+			exactGroup[sub.ID] = key
+		}
+		findings = append(findings, newFinding(KindExact, 1, fmt.Sprintf("%d subscriptions named %q with the same price and billing cycle", len(group), group[0].Name), group))
+	}
+
+	related := map[int]bool{}
+	for i := 0; i < len(active); i++ {
+		for j := i + 1; j < len(active); j++ {
+			a, b := active[i], active[j]
+			if key, ok := exactGroup[a.ID]; ok && exactGroup[b.ID] == key {
+				related[a.ID], related[b.ID] = true, true
+				continue
+			}
+
+			if finding, ok := comparePair(a, b, resolver); ok {
+				related[a.ID], related[b.ID] = true, true
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	// Several different services in one category, e.g. three video streaming
+	// services, are worth a look even when none is a duplicate
+	byCategory := map[string][]models.Subscription{}
+	for _, sub := range active {
+		category := strings.ToLower(strings.TrimSpace(sub.Category))
+		if category == "" || category == "other" || related[sub.ID] {
+			continue
+		}
+		byCategory[category] = append(byCategory[category], sub)
+	}
+	for _, group := range byCategory {
+		if len(group) < 2 {
+			continue
+		}
+		findings = append(findings, newFinding(KindOverlap, 0.3, fmt.Sprintf("%d different services in the %s category", len(group), group[0].Category), group))
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Score != findings[j].Score {
+			return findings[i].Score > findings[j].Score
+		}
+		return findings[i].Subscriptions[0].ID < findings[j].Subscriptions[0].ID
+	})
+
+	return models.DuplicateReport{Findings: findings}
+}
+
+// FindSimilar returns the exact, fuzzy and bundle findings between candidate
+// and the user's existing active subscriptions
+func FindSimilar(candidate models.Subscription, existing []models.Subscription, resolver Resolver) []models.DuplicateFinding {
+	findings := []models.DuplicateFinding{}
+	for _, sub := range existing {
+		if !sub.IsActive || sub.ID == candidate.ID {
+			continue
+		}
+
+		if finding, ok := comparePair(sub, candidate, resolver); ok {
+			findings = append(findings, finding)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Score > findings[j].Score
+	})
+
+	return findings
+}
+
+// comparePair reports whether a and b are the same service or one is part of
+// a bundle the other provides
+func comparePair(a, b models.Subscription, resolver Resolver) (models.DuplicateFinding, bool) {
+	var serviceA, serviceB models.CatalogService
+	var resolvedA, resolvedB bool
+	if resolver != nil {
+		serviceA, resolvedA = resolver.Resolve(a.Name)
+		serviceB, resolvedB = resolver.Resolve(b.Name)
+	}
+
+	if resolvedA && resolvedB && serviceA.ID != serviceB.ID {
+		if contains(serviceA.Includes, serviceB.ID) {
+			return bundleFinding(a, b, serviceA), true
+		}
+		if contains(serviceB.Includes, serviceA.ID) {
+			return bundleFinding(b, a, serviceB), true
+		}
+	}
+
+	keyA, keyB := nameKey(a.Name), nameKey(b.Name)
+	nameScore := similarity(keyA, keyB)
+	sameService := keyA == keyB || (resolvedA && resolvedB && serviceA.ID == serviceB.ID)
+	if sameService {
+		nameScore = 1
+	} else if nameScore < nameSimilarityThreshold || len(keyA) < 4 || len(keyB) < 4 {
+		return models.DuplicateFinding{}, false
+	}
+
+	if keyA == keyB && a.Price == b.Price && a.BillingCycle == b.BillingCycle {
+		return newFinding(KindExact, 1, fmt.Sprintf("%q is tracked twice with the same price and billing cycle", a.Name), []models.Subscription{a, b}), true
+	}
+
+	costA := billing.MonthlyCost(a.Price, a.BillingCycle)
+	costB := billing.MonthlyCost(b.Price, b.BillingCycle)
+	priceScore := 1.0
+	if highest := math.Max(costA, costB); highest > 0 {
+		priceScore = 1 - math.Min(1, math.Abs(costA-costB)/highest)
+	}
+	dateScore := 1 - math.Min(1, float64(billingDayDistance(a, b))/15)
+
+	score := 0.6*nameScore + 0.25*priceScore + 0.15*dateScore
+	reason := fmt.Sprintf("%q and %q look like the same service", a.Name, b.Name)
+
+	return newFinding(KindFuzzy, score, reason, []models.Subscription{a, b}), true
+}
+
+// Helper functions
+func bundleFinding(bundle, standalone models.Subscription, service models.CatalogService) models.DuplicateFinding {
+	finding := newFinding(KindBundle, 0.9, fmt.Sprintf("%q is already included in %s", standalone.Name, service.Name), []models.Subscription{bundle, standalone})
+	finding.MonthlySavings = round(billing.MonthlyCost(standalone.Price, standalone.BillingCycle))
+	return finding
+}
+
+func newFinding(kind string, score float64, reason string, subscriptions []models.Subscription) models.DuplicateFinding {
+	finding := models.DuplicateFinding{
+		Kind:   kind,
+		Score:  math.Round(score*100) / 100,
+		Reason: reason,
+	}
+
+	var total, highest float64
+	for _, sub := range subscriptions {
+		cost := billing.MonthlyCost(sub.Price, sub.BillingCycle)
+		total += cost
+		highest = math.Max(highest, cost)
+
+		finding.Subscriptions = append(finding.Subscriptions, models.DuplicateSubscription{
+			ID:              sub.ID,
+			Name:            sub.Name,
+			Category:        sub.Category,
+			Price:           sub.Price,
+			BillingCycle:    sub.BillingCycle,
+			NextBillingDate: sub.NextBillingDate.Format("2006-01-02"),
+		})
+	}
+
+	if kind != KindOverlap {
+		finding.MonthlySavings = round(total - highest)
+	}
+
+	return finding
+}
+
+// nameKey normalizes a subscription name and drops plan words, so "Dropbox
+// Plus" and "dropbox" share a key
+func nameKey(name string) string {
+	tokens := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var kept []string
+	for _, token := range tokens {
+		if !planWords[token] {
+			kept = append(kept, token)
+		}
+	}
+	if len(kept) == 0 {
+		kept = tokens
+	}
+
+	return strings.Join(kept, " ")
+}
+
+// similarity is 1 minus the Levenshtein distance relative to the longer string
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	longest := max(len(ra), len(rb))
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
+
+// billingDayDistance compares billing dates by day of month for monthly
+// cycles and by calendar distance otherwise
+func billingDayDistance(a, b models.Subscription) int {
+	if a.BillingCycle == billing.CycleMonthly && b.BillingCycle == billing.CycleMonthly {
+		diff := a.NextBillingDate.Day() - b.NextBillingDate.Day()
+		if diff < 0 {
+			diff = -diff
+		}
+		return min(diff, 31-diff)
+	}
+
+	days := int(math.Abs(billing.Day(a.NextBillingDate).Sub(billing.Day(b.NextBillingDate)).Hours() / 24))
+	return days
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -3,8 +3,10 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"os"
 	"strings"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
 	"subscription-tracker/internal/utils"
 )
 
@@ -14,14 +16,14 @@ func AuthMiddleware(db models.Database) func(http.Handler) http.Handler {
 			// Get token from authorization header
 			authHeaer := r.Header.Get("Authorization")
 			if authHeaer == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header required")
 				return
 			}
 
 			// Check if the header has Bearer format
 			parts := strings.Split(authHeaer, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "Authorization header format must be: Bearer {token}", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header format must be: Bearer {token}")
 				return
 			}
 
@@ -29,20 +31,83 @@ func AuthMiddleware(db models.Database) func(http.Handler) http.Handler {
 
 			claims, err := utils.ValidateJWT(tokenString)
 			if err != nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Access token is invalid or expired")
 				return
 			}
 
-			// Get user form db
-			user, err := db.GetUserByID(claims.UserID)
+			serveAuthenticated(w, r, db, claims, next)
+		})
+	}
+}
+
+// EventStreamAuth authenticates the event stream. EventSource can't send an
+// Authorization header, so besides a bearer token it accepts a short-lived
+// stream token in the token query parameter. Like an access token, a stream
+// token stops working once its session is signed out.
+func EventStreamAuth(db models.Database) func(http.Handler) http.Handler {
+	bearer := AuthMiddleware(db)
+	return func(next http.Handler) http.Handler {
+		withBearer := bearer(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := r.URL.Query().Get("token")
+			if tokenString == "" {
+				withBearer.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := utils.ValidatePurposeJWT(tokenString, utils.PurposeEventStream)
 			if err != nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Stream token is invalid or expired")
+				return
+			}
+
+			serveAuthenticated(w, r, db, claims, next)
+		})
+	}
+}
+
+// serveAuthenticated loads the user and session of validated claims into the
+// request context and calls next, or answers 401 if either is gone
+func serveAuthenticated(w http.ResponseWriter, r *http.Request, db models.Database, claims *utils.Claims, next http.Handler) {
+	// Get user form db
+	user, err := db.GetUserByID(claims.UserID)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Access token is invalid or expired")
+		return
+	}
+
+	// Reject tokens of sessions that were signed out
+	session, err := db.GetSession(claims.SessionID, claims.UserID)
+	if err != nil || session.RevokedAt != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Session has ended, sign in again")
+		return
+	}
+
+	// Add user and session to context
+	ctx := context.WithValue(r.Context(), "user", user)
+	ctx = context.WithValue(ctx, "sessionID", session.ID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// AdminMiddleware allows only users listed in the comma-separated ADMIN_EMAILS
+// environment variable. It must run after AuthMiddleware.
+func AdminMiddleware() func(http.Handler) http.Handler {
+	admins := map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			admins[email] = true
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value("user").(*models.User)
+			if !ok || !admins[strings.ToLower(user.Email)] {
+				problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "Admin access required")
 				return
 			}
 
-			// Add user to context
-			ctx := context.WithValue(r.Context(), "user", user)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r)
 		})
 	}
 }
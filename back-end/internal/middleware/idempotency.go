@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+
+	"subscription-tracker/internal/idempotency"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	maxIdempotentRequestSize = 10 << 20 // 10 MB, the largest upload we accept
+)
+
+var idempotentMethods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// Response headers replayed together with the stored body
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "Location", "ETag", "Last-Modified"}
+
+// Idempotency makes POST, PUT, PATCH and DELETE requests that carry an
+// Idempotency-Key header safe to retry. The first response for a key is
+// stored and replayed for later requests with the same key, method, URL
+// including the query string, and body. Keys are scoped to the user, so it
+// must run after AuthMiddleware. Server errors are not stored, so those
+// requests can be retried. Responses are stored as they are, so it must not
+// wrap routes that return secrets.
+func Idempotency(store *idempotency.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			user, ok := r.Context().Value("user").(*models.User)
+			if store == nil || key == "" || !ok || !idempotentMethods[r.Method] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !validIdempotencyKey(key) {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Idempotency-Key must be 1 to 255 printable ASCII characters")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestSize))
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Request body could not be read")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			fingerprint := idempotency.Fingerprint(r.Method, r.URL.RequestURI(), body)
+			existing, err := store.Reserve(user.ID, key, fingerprint)
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+				case !existing.Completed:
+					problem.Write(w, r, http.StatusConflict, problem.CodeIdempotencyKeyInUse, "A request with this Idempotency-Key is still being processed")
+				default:
+					replayResponse(w, existing)
+				}
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status >= http.StatusInternalServerError {
+				if err := store.Release(user.ID, key); err != nil {
+					log.Printf("Failed to release idempotency key for user %d: %v", user.ID, err)
+				}
+				return
+			}
+
+			record := models.IdempotencyRecord{
+				UserID:      user.ID,
+				Key:         key,
+				Fingerprint: fingerprint,
+				StatusCode:  recorder.status,
+				Header:      http.Header{},
+				Body:        recorder.body.Bytes(),
+			}
+			for _, name := range replayedHeaders {
+				if value := w.Header().Get(name); value != "" {
+					record.Header.Set(name, value)
+				}
+			}
+
+			if err := store.Complete(record); err != nil {
+				log.Printf("Failed to store idempotent response for user %d: %v", user.ID, err)
+			}
+		})
+	}
+}
+
+// Helper functions
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func replayResponse(w http.ResponseWriter, record *models.IdempotencyRecord) {
+	for name, values := range record.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// responseRecorder passes the response through while keeping a copy of the
+// status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+type MonthlySpend struct {
+	Month string  `json:"month"` // YYYY-MM
+	Total float64 `json:"total"`
+	Count int     `json:"count"`
+}
+
+type SpendingTrend struct {
+	From   string         `json:"from"`
+	To     string         `json:"to"`
+	Total  float64        `json:"total"`
+	Months []MonthlySpend `json:"months"`
+}
+
+type BreakdownItem struct {
+	Key         string  `json:"key"`
+	MonthlyCost float64 `json:"monthlyCost"`
+	Count       int     `json:"count"`
+	Share       float64 `json:"share"` // fraction of total monthly cost
+}
+
+type SpendingBreakdown struct {
+	TotalMonthly   float64         `json:"totalMonthly"`
+	ByCategory     []BreakdownItem `json:"byCategory"`
+	ByBillingCycle []BreakdownItem `json:"byBillingCycle"`
+}
+
+type SpendingForecast struct {
+	From   string         `json:"from"`
+	To     string         `json:"to"`
+	Total  float64        `json:"total"`
+	Months []MonthlySpend `json:"months"`
+}
+
+type CalendarOccurrence struct {
+	SubscriptionID int     `json:"subscriptionId"`
+	Name           string  `json:"name"`
+	Category       string  `json:"category"`
+	BillingCycle   string  `json:"billingCycle"`
+	Amount         float64 `json:"amount"`
+}
+
+type CalendarDay struct {
+	Date         string               `json:"date"` // YYYY-MM-DD
+	Total        float64              `json:"total"`
+	RunningTotal float64              `json:"runningTotal"`
+	Occurrences  []CalendarOccurrence `json:"occurrences"`
+}
+
+type Calendar struct {
+	From  string        `json:"from"`
+	To    string        `json:"to"`
+	Total float64       `json:"total"`
+	Days  []CalendarDay `json:"days"`
+}
+
+type CalendarFeedResponse struct {
+	Message string `json:"message"`
+	URL     string `json:"url"`
+}
+
+// CalendarFeed tells whether the user has a calendar feed. The feed URL
+// carries a secret token of which only the hash is stored.
+type CalendarFeed struct {
+	Enabled   bool       `json:"enabled"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+type DuplicateSubscription struct {
+	ID              int     `json:"id"`
+	Name            string  `json:"name"`
+	Category        string  `json:"category"`
+	Price           float64 `json:"price"`
+	BillingCycle    string  `json:"billingCycle"`
+	NextBillingDate string  `json:"nextBillingDate"`
+}
+
+type DuplicateFinding struct {
+	Kind           string                  `json:"kind"` // exact, fuzzy, bundle or overlap
+	Score          float64                 `json:"score"`
+	Reason         string                  `json:"reason"`
+	MonthlySavings float64                 `json:"monthlySavings"` // if all but the most expensive were cancelled
+	Subscriptions  []DuplicateSubscription `json:"subscriptions"`
+}
+
+type DuplicateReport struct {
+	Findings []DuplicateFinding `json:"findings"`
+}
@@ -0,0 +1,19 @@
+package models
+
+type CatalogPlan struct {
+	ID           string  `json:"id"` // "<service id>:<plan>"
+	Name         string  `json:"name" validate:"required,notblank"`
+	Price        float64 `json:"price" validate:"gt=0"`
+	BillingCycle string  `json:"billingCycle" validate:"oneof=monthly yearly weekly"`
+	Currency     string  `json:"currency" validate:"len=3"` // ISO 4217
+}
+
+type CatalogService struct {
+	ID       string        `json:"id" validate:"slug"`
+	Name     string        `json:"name" validate:"required,notblank"`
+	Aliases  []string      `json:"aliases"`
+	Category string        `json:"category" validate:"required,notblank"`
+	LogoKey  string        `json:"logoKey"`
+	Includes []string      `json:"includes,omitempty" validate:"dive,slug"` // IDs of services bundled into this one
+	Plans    []CatalogPlan `json:"plans" validate:"dive"`
+}
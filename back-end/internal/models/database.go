@@ -1,11 +1,16 @@
 package models
 
+import "time"
+
 type Database interface {
 	GetUserSubscriptions(userID int) ([]Subscription, error)
 	GetSubscriptionByID(id int) (*Subscription, error)
 	CreateSubscription(req CreateSubscriptionRequest, userID int) (*Subscription, error)
-	UpdateSubscription(id int, req CreateSubscriptionRequest) (*Subscription, error)
-	DeleteSubscription(id int, userID int) error
+	UpdateSubscription(id int, userID int, version int, req CreateSubscriptionRequest) (*Subscription, error)
+	PatchSubscription(id int, userID int, version int, patch SubscriptionPatch) (*Subscription, error)
+	DeleteSubscription(id int, userID int, version int) error
+	ImportSubscriptions(userID int, items []SubscriptionImport) ([]Subscription, error)
+	BatchSubscriptions(userID int, ops []BatchOperation, atomic bool) ([]BatchResult, bool, error)
 	GetUpcomingSubscriptions() ([]Subscription, error)
 
 	GetUserSubscriptionsStats(userID int) (*SubscriptionStats, error)
@@ -13,5 +18,76 @@ type Database interface {
 	CreateUser(user User) (*User, error)
 	GetUserByID(id int) (*User, error)
 	GetUserByEmail(email string) (*User, error)
+	VerifyUserEmail(userID int, email string) error
+	UpdateUserName(id int, name string) (*User, error)
+	ChangeUserPassword(id int, passwordHash string, keepSessionID int) error
+	ChangeUserEmail(id int, currentEmail string, newEmail string) (*User, error)
+	DeleteUser(id int) error
+
+	CreatePasswordResetToken(userID int, tokenHash string, ttl time.Duration) error
+	ResetPassword(tokenHash string, passwordHash string) (int, error)
+	DeleteExpiredPasswordResetTokens() (int64, error)
+
+	GetTOTP(userID int) (*TOTP, error)
+	SaveTOTPSecret(userID int, secret string) error
+	EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(userID int, step int64) error
+	UseRecoveryCode(userID int, codeHash string) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	DisableTOTP(userID int) error
+
+	SetWebAuthnID(userID int, handle []byte) ([]byte, error)
+	GetUserByWebAuthnID(handle []byte) (*User, error)
+	CreatePasskey(passkey Passkey) (*Passkey, error)
+	GetUserPasskeys(userID int) ([]Passkey, error)
+	GetPasskeyByCredentialID(credentialID []byte) (*Passkey, error)
+	UpdatePasskeyUsage(id int, signCount uint32, credential []byte) error
+	DeletePasskey(id int, userID int) error
+	CreateWebAuthnCeremony(ceremony WebAuthnCeremony, ttl time.Duration) error
+	ConsumeWebAuthnCeremony(idHash string, kind string) (*WebAuthnCeremony, error)
+	DeleteExpiredWebAuthnCeremonies() (int64, error)
+
+	RotateRefreshToken(tokenHash string, next RefreshToken, ttl, reuseGrace time.Duration) (*RefreshToken, error)
+	RevokeRefreshTokenFamily(tokenHash string) error
+	DeleteExpiredRefreshTokens() (int64, error)
+
+	CreateSession(session Session, tokenHash string, ttl time.Duration) (*Session, error)
+	TouchSession(familyID string, userAgent string, ipAddress string) (*Session, error)
+	GetSession(id int, userID int) (*Session, error)
+	GetUserSessions(userID int) ([]Session, error)
+	RevokeSession(id int, userID int) error
+	RevokeOtherSessions(userID int, keepID int) (int64, error)
+
+	SetCalendarFeedToken(userID int, tokenHash string) error
+	DeleteCalendarFeedToken(userID int) error
+	GetCalendarFeed(userID int) (*CalendarFeed, error)
+	GetUserByCalendarFeedToken(tokenHash string) (*User, error)
+
+	SeedCatalogServices(services []CatalogService) error
+	GetCatalogServices() ([]CatalogService, error)
+	UpsertCatalogService(service CatalogService) error
+	DeleteCatalogService(id string) error
+
+	CreateWebhook(webhook Webhook) (*Webhook, error)
+	GetUserWebhooks(userID int) ([]Webhook, error)
+	GetWebhook(id int, userID int) (*Webhook, error)
+	UpdateWebhook(webhook Webhook) (*Webhook, error)
+	DeleteWebhook(id int, userID int) error
+	GetWebhooksForEvent(userID int, event string) ([]Webhook, error)
+	CreateWebhookDelivery(delivery WebhookDelivery) error
+	ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, error)
+	RecordWebhookAttempt(id int, attempt WebhookAttempt) error
+	GetWebhookDeliveries(webhookID int, userID int, limit int) ([]WebhookDelivery, error)
+	GetUserWebhookDeliveries(userID int) ([]WebhookDelivery, error)
+	ReplayWebhookDelivery(id int, webhookID int, userID int) (*WebhookDelivery, error)
+	DeleteWebhookDeliveriesOlderThan(age time.Duration) (int64, error)
+	GetSubscriptionsWithWebhooks() ([]Subscription, error)
+
+	ReserveIdempotencyKey(record IdempotencyRecord, lease time.Duration) (bool, error)
+	GetIdempotencyKey(userID int, key string) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(record IdempotencyRecord, ttl time.Duration) error
+	DeleteIdempotencyKey(userID int, key string) error
+	DeleteExpiredIdempotencyKeys() (int64, error)
+
 	Close() error
 }
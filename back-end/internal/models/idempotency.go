@@ -0,0 +1,16 @@
+package models
+
+import "net/http"
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header. Until the first request finishes it is kept with
+// Completed false, and retries are told the key is still in use.
+type IdempotencyRecord struct {
+	UserID      int         `json:"userId"`
+	Key         string      `json:"key"`
+	Fingerprint string      `json:"fingerprint"` // hash of method, path and body
+	Completed   bool        `json:"completed"`
+	StatusCode  int         `json:"statusCode,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
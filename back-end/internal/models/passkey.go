@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Passkey is a WebAuthn credential registered to a user
+type Passkey struct {
+	ID           int             `json:"id"`
+	UserID       int             `json:"-"`
+	CredentialID []byte          `json:"-"`
+	Name         string          `json:"name"`
+	Credential   json.RawMessage `json:"-"` // the WebAuthn credential record
+	SignCount    uint32          `json:"-"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	LastUsedAt   *time.Time      `json:"lastUsedAt,omitempty"`
+}
+
+// WebAuthnCeremony holds the server side of a registration or sign-in while
+// the browser talks to the authenticator
+type WebAuthnCeremony struct {
+	IDHash  string
+	UserID  int // 0 for sign-in, where the user isn't known until the assertion
+	Kind    string
+	Session json.RawMessage
+}
+
+type PasskeyCeremonyResponse struct {
+	CeremonyID string      `json:"ceremonyId"`
+	Options    interface{} `json:"options"` // pass options.publicKey to navigator.credentials
+}
+
+type FinishPasskeyRegistrationRequest struct {
+	CeremonyID string          `json:"ceremonyId" validate:"required"`
+	Name       string          `json:"name" validate:"max=100"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+type FinishPasskeyLoginRequest struct {
+	CeremonyID string          `json:"ceremonyId" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// Problem is an RFC 7807 problem details response. Code is a stable,
+// machine-readable identifier clients can switch on; Detail is for humans.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`  // only for validation_failed
+	Current   interface{}  `json:"current,omitempty"` // current state of the resource, for version conflicts
+}
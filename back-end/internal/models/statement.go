@@ -0,0 +1,21 @@
+package models
+
+type RecurringCandidate struct {
+	Merchant       string                    `json:"merchant"`
+	NormalizedName string                    `json:"normalizedName"`
+	BillingCycle   string                    `json:"billingCycle"`
+	Amount         float64                   `json:"amount"`
+	Currency       string                    `json:"currency,omitempty"`
+	Occurrences    int                       `json:"occurrences"`
+	FirstSeen      string                    `json:"firstSeen"`
+	LastSeen       string                    `json:"lastSeen"`
+	Confidence     float64                   `json:"confidence"` // 0 to 1
+	AlreadyTracked bool                      `json:"alreadyTracked"`
+	Subscription   CreateSubscriptionRequest `json:"subscription"` // ready to POST to /subscriptions
+}
+
+type StatementAnalysis struct {
+	Format       string               `json:"format"`
+	Transactions int                  `json:"transactions"`
+	Candidates   []RecurringCandidate `json:"candidates"`
+}
@@ -1,9 +1,21 @@
 package models
 
 import (
+	"errors"
 	"time"
 )
 
+// ErrVersionConflict is returned by writes based on a version of a
+// subscription that is no longer current
+var ErrVersionConflict = errors.New("subscription version conflict")
+
+// Outcomes of batch operations that were undone or skipped because another
+// operation of an atomic batch failed
+var (
+	ErrBatchRolledBack   = errors.New("rolled back because another operation failed")
+	ErrBatchNotAttempted = errors.New("not attempted because another operation failed")
+)
+
 type Subscription struct {
 	ID              int       `json:"id"`
 	Name            string    `json:"name"`
@@ -16,14 +28,35 @@ type Subscription struct {
 	UserID          int       `json:"user_id"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
+	Version         int       `json:"version"` // bumped on every write
 }
 
 type CreateSubscriptionRequest struct {
-	Name            string  `json:"name" validate:"required"`
-	Price           float64 `json:"price" validate:"required,gt=0"`
-	Category        string  `json:"category" validate:"required"`
+	Name            string  `json:"name" validate:"required,notblank,max=255"`
+	Price           float64 `json:"price" validate:"required,gt=0,lt=100000000"` // DECIMAL(10,2)
+	Category        string  `json:"category" validate:"required,notblank,max=100"`
 	BillingCycle    string  `json:"billingCycle" validate:"required,oneof=monthly yearly weekly"`
-	NextBillingDate string  `json:"nextBillingDate" validate:"required"`
+	NextBillingDate string  `json:"nextBillingDate" validate:"required,date"`
+	CatalogPlanID   string  `json:"catalogPlanId,omitempty"`                      // pre-fills empty fields from the service catalog
+	Version         *int    `json:"version,omitempty" validate:"omitempty,min=1"` // version an update is based on, ignored on create
+}
+
+// SubscriptionPatch holds the columns a PATCH changes. Nil fields are left
+// untouched.
+type SubscriptionPatch struct {
+	Name            *string
+	Category        *string
+	Price           *float64
+	BillingCycle    *string
+	NextBillingDate *string
+	IsActive        *bool
+}
+
+// CreateSubscriptionResponse is the created subscription plus warnings about
+// near-duplicates the user already has
+type CreateSubscriptionResponse struct {
+	Subscription
+	Warnings []DuplicateFinding `json:"warnings,omitempty"`
 }
 
 type SubscriptionStats struct {
@@ -31,3 +64,71 @@ type SubscriptionStats struct {
 	ActiveCount  int     `json:"activeCount"`
 	NextPayment  float64 `json:"nextPayment"`
 }
+
+// SubscriptionImport is a single write of an import. ID is the subscription to
+// update, or 0 to create a new one. Version is the version the row was matched
+// against, so an update fails if the subscription changed since. IsActive is
+// left as it is when nil, so new subscriptions start active.
+type SubscriptionImport struct {
+	ID       int
+	Version  int
+	Request  CreateSubscriptionRequest
+	IsActive *bool
+}
+
+type ImportRowResult struct {
+	Row            int                        `json:"row"`
+	Action         string                     `json:"action"` // create, update, skip or error
+	SubscriptionID int                        `json:"subscriptionId,omitempty"`
+	Subscription   *CreateSubscriptionRequest `json:"subscription,omitempty"`
+	IsActive       *bool                      `json:"isActive,omitempty"`
+	Errors         []string                   `json:"errors,omitempty"`
+}
+
+type ImportResult struct {
+	DryRun  bool              `json:"dryRun"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Skipped int               `json:"skipped"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// Batch operation types
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+type BatchOperation struct {
+	Op           string                    `json:"op"`
+	ID           int                       `json:"id,omitempty"`      // update and delete
+	Version      int                       `json:"version,omitempty"` // update and delete, required
+	Subscription CreateSubscriptionRequest `json:"subscription"`      // create and update
+}
+
+type BatchRequest struct {
+	// atomic (default) rolls everything back on the first failure,
+	// bestEffort applies every operation that succeeds
+	Mode       string           `json:"mode" validate:"omitempty,oneof=atomic bestEffort"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,max=500"`
+}
+
+type BatchResult struct {
+	Index        int           `json:"index"`
+	Op           string        `json:"op"`
+	ID           int           `json:"id,omitempty"`
+	Status       int           `json:"status"` // HTTP status the single-item endpoint would return
+	Subscription *Subscription `json:"subscription,omitempty"`
+	Errors       []string      `json:"errors,omitempty"`
+	Err          error         `json:"-"` // why the operation failed when run
+}
+
+type BatchResponse struct {
+	Mode      string        `json:"mode"`
+	Committed bool          `json:"committed"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
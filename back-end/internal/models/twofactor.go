@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// TOTP is the authenticator app secret of a user. It only protects sign-in
+// once EnabledAt is set, which happens when the user confirms a first code.
+type TOTP struct {
+	UserID            int
+	Secret            string
+	LastUsedStep      int64 // time step of the last accepted code, so codes can't be replayed
+	EnabledAt         *time.Time
+	RecoveryCodesLeft int
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"` // encode as a QR code for authenticator apps
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"` // for email/password accounts
+	Code     string `json:"code"`     // fresh Google authorization code for Google accounts
+}
+
+// LoginChallenge is returned by sign-in instead of tokens when the account
+// has two-factor authentication enabled
+type LoginChallenge struct {
+	Message        string   `json:"message"`
+	ChallengeToken string   `json:"challengeToken"`
+	Methods        []string `json:"methods"`
+}
+
+type LoginChallengeRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required"` // authenticator code or recovery code
+}
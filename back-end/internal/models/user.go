@@ -1,21 +1,32 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrEmailTaken is returned when another account already uses an email
+var ErrEmailTaken = errors.New("email already in use")
+
+// ErrRefreshTokenReused is returned when a refresh token that was already
+// rotated is presented again. Its whole family has been revoked by then.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
 
 type User struct {
-	ID           int       `json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"password_hash"`
-	ThirdParty   string    `json:"third_party"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"update_at"`
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"-"`
+	ThirdParty    string    `json:"third_party"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"update_at"`
 }
 
 type RegisterReq struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Name     string `json:"name"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,password"`
+	Name     string `json:"name" validate:"required,notblank,max=100"`
 }
 
 type AuthResponse struct {
@@ -24,14 +35,49 @@ type AuthResponse struct {
 	User    User   `json:"user"`
 }
 
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+type UpdateProfileRequest struct {
+	Name string `json:"name" validate:"required,notblank,max=100"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,password"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required"` // current password, to confirm the change
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
 type AccessTokenResponse struct {
 	Message string `json:"message"`
 	Token   string `json:"token"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 type GoogleUser struct {
@@ -44,3 +90,57 @@ type GoogleUser struct {
 	Picture       string `json:"picture"`
 	Locale        string `json:"locale"`
 }
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"` // for email/password accounts
+	Code     string `json:"code"`     // fresh Google authorization code for Google accounts
+}
+
+type AccountProfile struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	ThirdParty string    `json:"third_party"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"update_at"`
+}
+
+// RefreshToken is a stored refresh token. Only the hash of the token is kept.
+// Every token issued by rotation shares the FamilyID of the one it replaced,
+// so a stolen token can be revoked together with its descendants.
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId"`
+	FamilyID  string     `json:"familyId"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Session is one sign-in on a device. It owns the refresh token family
+// started by that sign-in and ends when the family is revoked.
+type Session struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	FamilyID   string     `json:"-"`
+	UserAgent  string     `json:"userAgent"`
+	IPAddress  string     `json:"ipAddress"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"` // whether the request was made with this session
+}
+
+// StreamTokenResponse carries a token for the token query parameter of the
+// event stream. ExpiresIn is in seconds.
+type StreamTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int    `json:"expiresIn"`
+}
+
+type RevokeSessionsResponse struct {
+	Message string `json:"message"`
+	Revoked int64  `json:"revoked"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// FieldError describes a single invalid field of a request body
+type FieldError struct {
+	Field   string `json:"field"`   // JSON path, e.g. "plans[0].price"
+	Code    string `json:"code"`    // the failed rule, e.g. "required" or "oneof"
+	Message string `json:"message"` // human-readable explanation
+}
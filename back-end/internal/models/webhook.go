@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"` // only returned once, on creation
+	IsActive  bool      `json:"isActive"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type WebhookRequest struct {
+	URL      string   `json:"url" validate:"required,url,max=2048"`
+	Events   []string `json:"events" validate:"required,min=1,dive,oneof=subscription.created subscription.updated subscription.deleted renewal.upcoming renewal.charged"`
+	IsActive *bool    `json:"isActive,omitempty"` // defaults to true
+}
+
+// CreateWebhookResponse includes the signing secret, which is never shown again
+type CreateWebhookResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookEvent is the JSON body POSTed to webhook endpoints
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhookId"`
+	EventID        string          `json:"eventId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // pending, succeeded or failed
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"responseStatus,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+
+	// Target of the delivery, filled in when it is claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookAttempt is the outcome of one delivery attempt
+type WebhookAttempt struct {
+	Status         string
+	ResponseStatus *int
+	Error          string
+	RetryIn        time.Duration // wait before the next attempt, 0 once no retries remain
+}
+
+// RenewalEvent is the data of renewal.upcoming and renewal.charged events
+type RenewalEvent struct {
+	Subscription Subscription `json:"subscription"`
+	Date         string       `json:"date"` // YYYY-MM-DD
+	Amount       float64      `json:"amount"`
+}
+
+// SubscriptionDeletedEvent is the data of subscription.deleted events
+type SubscriptionDeletedEvent struct {
+	ID int `json:"id"`
+}
@@ -0,0 +1,16 @@
+package openapi
+
+import (
+	_ "embed"
+)
+
+// Spec is the OpenAPI 3.1 document of the API. Keep it in sync with the routes
+// in cmd/server; the route coverage test fails when they drift apart.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// DocsPage is a self-contained docs UI that renders Spec and can send requests
+//
+//go:embed docs.html
+var DocsPage []byte
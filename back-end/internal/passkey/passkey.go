@@ -0,0 +1,98 @@
+// Package passkey configures WebAuthn and adapts accounts and their stored
+// passkeys to what the WebAuthn ceremonies expect
+package passkey
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	// CeremonyTTL is how long the browser has to finish a ceremony
+	CeremonyTTL = 5 * time.Minute
+
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+
+	displayName = "Subscription Tracker"
+)
+
+type Config struct {
+	RPID      string   // domain passkeys are bound to
+	RPOrigins []string // origins the browser may run ceremonies from
+}
+
+// ConfigFromEnv binds passkeys to the front-end. WEBAUTHN_RP_ID can widen
+// the domain to a parent of the front-end's host.
+func ConfigFromEnv() Config {
+	origin := strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/")
+	if origin == "" {
+		origin = "http://localhost:3000"
+	}
+
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		if parsed, err := url.Parse(origin); err == nil {
+			rpID = parsed.Hostname()
+		}
+	}
+
+	return Config{RPID: rpID, RPOrigins: []string{origin}}
+}
+
+func New(config Config) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          config.RPID,
+		RPDisplayName: displayName,
+		RPOrigins:     config.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: CeremonyTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: CeremonyTTL},
+		},
+	})
+}
+
+// User is an account as a WebAuthn user. Handle is the random user handle
+// authenticators store with the passkey.
+type User struct {
+	Account     models.User
+	Handle      []byte
+	Credentials []webauthn.Credential
+}
+
+// NewUser decodes the stored passkeys of an account
+func NewUser(account models.User, handle []byte, passkeys []models.Passkey) (*User, error) {
+	credentials := make([]webauthn.Credential, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(passkey.Credential, &credential); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return &User{Account: account, Handle: handle, Credentials: credentials}, nil
+}
+
+func (u *User) WebAuthnID() []byte {
+	return u.Handle
+}
+
+func (u *User) WebAuthnName() string {
+	return u.Account.Email
+}
+
+func (u *User) WebAuthnDisplayName() string {
+	return u.Account.Name
+}
+
+func (u *User) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
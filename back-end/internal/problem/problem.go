@@ -0,0 +1,146 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"subscription-tracker/internal/models"
+)
+
+// ContentType is the media type of every error response
+const ContentType = "application/problem+json"
+
+// Stable error codes. Clients switch on these, so existing values must never
+// change meaning.
+const (
+	CodeBadRequest               = "bad_request"
+	CodeInvalidJSON              = "invalid_json"
+	CodeInvalidParameter         = "invalid_parameter"
+	CodeInvalidFile              = "invalid_file"
+	CodeInvalidPatch             = "invalid_patch"
+	CodeValidationFailed         = "validation_failed"
+	CodeUnauthorized             = "unauthorized"
+	CodeInvalidToken             = "invalid_token"
+	CodeInvalidCredentials       = "invalid_credentials"
+	CodeInvalidCode              = "invalid_code"
+	CodeReauthenticationRequired = "reauthentication_required"
+	CodeForbidden                = "forbidden"
+	CodeNotFound                 = "not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeEmailTaken               = "email_taken"
+	CodeTwoFactorEnabled         = "two_factor_enabled"
+	CodeVersionConflict          = "version_conflict"
+	CodePreconditionFailed       = "precondition_failed"
+	CodePreconditionRequired     = "precondition_required"
+	CodeLimitReached             = "limit_reached"
+	CodeRateLimited              = "rate_limited"
+	CodeIdempotencyKeyInUse      = "idempotency_key_in_use"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeUnsupportedMediaType     = "unsupported_media_type"
+	CodeInternal                 = "internal_error"
+)
+
+const typePrefix = "urn:subscription-tracker:problem:"
+
+var titles = map[string]string{
+	CodeBadRequest:               "Bad request",
+	CodeInvalidJSON:              "Invalid JSON",
+	CodeInvalidParameter:         "Invalid parameter",
+	CodeInvalidFile:              "Invalid file",
+	CodeInvalidPatch:             "Invalid patch",
+	CodeValidationFailed:         "Validation failed",
+	CodeUnauthorized:             "Authentication required",
+	CodeInvalidToken:             "Invalid token",
+	CodeInvalidCredentials:       "Invalid credentials",
+	CodeInvalidCode:              "Invalid code",
+	CodeReauthenticationRequired: "Re-authentication required",
+	CodeForbidden:                "Forbidden",
+	CodeNotFound:                 "Not found",
+	CodeMethodNotAllowed:         "Method not allowed",
+	CodeEmailTaken:               "Email already in use",
+	CodeTwoFactorEnabled:         "Two-factor authentication already enabled",
+	CodeVersionConflict:          "Version conflict",
+	CodePreconditionFailed:       "Precondition failed",
+	CodePreconditionRequired:     "Precondition required",
+	CodeLimitReached:             "Limit reached",
+	CodeRateLimited:              "Too many requests",
+	CodeIdempotencyKeyInUse:      "Idempotency key in use",
+	CodeIdempotencyKeyReused:     "Idempotency key reused",
+	CodeUnsupportedMediaType:     "Unsupported media type",
+	CodeInternal:                 "Internal server error",
+}
+
+type contextKey struct{}
+
+// WithRequestID stores the request ID in ctx
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+// RequestID returns the request ID stored in ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey{}).(string)
+	return requestID
+}
+
+// New builds the problem for code without writing it
+func New(r *http.Request, status int, code, detail string) models.Problem {
+	title, ok := titles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+
+	return models.Problem{
+		Type:      typePrefix + code,
+		Title:     title,
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: RequestID(r.Context()),
+	}
+}
+
+// Write responds with a problem. detail is shown to the client as is, so it
+// must never contain internal error text.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Send(w, New(r, status, code, detail))
+}
+
+// Send writes an already built problem
+func Send(w http.ResponseWriter, p models.Problem) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Validation responds with 422 and the list of invalid fields
+func Validation(w http.ResponseWriter, r *http.Request, fieldErrors []models.FieldError) {
+	p := New(r, http.StatusUnprocessableEntity, CodeValidationFailed, "One or more fields are invalid")
+	p.Errors = fieldErrors
+	Send(w, p)
+}
+
+// Internal logs err with the request ID and responds with a generic 500 so
+// that database and driver errors never reach the client
+func Internal(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("[%s] %s %s: %v", RequestID(r.Context()), r.Method, r.URL.Path, err)
+	Write(w, r, http.StatusInternalServerError, CodeInternal, "An unexpected error occurred. Quote the request ID when reporting it.")
+}
+
+// NotFoundHandler answers unknown routes with a problem
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, http.StatusNotFound, CodeNotFound, "No route matches "+r.URL.Path)
+	})
+}
+
+// MethodNotAllowedHandler answers known routes called with the wrong method
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	})
+}
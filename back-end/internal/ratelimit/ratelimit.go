@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"subscription-tracker/internal/redis"
+)
+
+// Limiter counts attempts per key in fixed windows. Counters live in Redis
+// when it is available, so limits hold across instances, and in memory
+// otherwise.
+type Limiter struct {
+	redisClient *redis.RedisClient
+	mu          sync.Mutex
+	windows     map[string]*window
+}
+
+type window struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewLimiter(redisClient *redis.RedisClient) *Limiter {
+	return &Limiter{
+		redisClient: redisClient,
+		windows:     map[string]*window{},
+	}
+}
+
+// Allow records an attempt for key and reports whether it is within limit
+// attempts per period. When it is not, it also returns how long until the
+// window resets.
+func (l *Limiter) Allow(key string, limit int, period time.Duration) (bool, time.Duration) {
+	if l.redisClient != nil {
+		count, ttl, err := l.redisClient.Incr(l.redisClient.GetRateLimitKey(key), period)
+		if err == nil {
+			if count > int64(limit) {
+				return false, ttl
+			}
+			return true, 0
+		}
+		// Fall through so a Redis outage does not lift the limit
+		log.Printf("Rate limit counter failed, counting in memory: %v", err)
+	}
+
+	return l.allowLocal(key, limit, period)
+}
+
+// Helper functions
+func (l *Limiter) allowLocal(key string, limit int, period time.Duration) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for k, w := range l.windows {
+		if !now.Before(w.resetAt) {
+			delete(l.windows, k)
+		}
+	}
+
+	w, ok := l.windows[key]
+	if !ok {
+		w = &window{resetAt: now.Add(period)}
+		l.windows[key] = w
+	}
+
+	w.count++
+	if w.count > limit {
+		return false, w.resetAt.Sub(now)
+	}
+	return true, 0
+}
@@ -54,6 +54,30 @@ func (r *RedisClient) Set(key string, value interface{}, expiration time.Duratio
 	return r.client.Set(r.ctx, key, jsonValue, expiration).Err()
 }
 
+// SetNX stores value only if key does not exist yet and reports whether it did
+func (r *RedisClient) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+
+	return r.client.SetNX(r.ctx, key, jsonValue, expiration).Result()
+}
+
+// Incr increments the counter at key and returns its new value and the time
+// left until it expires. A new counter expires after expiration.
+func (r *RedisClient) Incr(key string, expiration time.Duration) (int64, time.Duration, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(r.ctx, key)
+	pipe.ExpireNX(r.ctx, key, expiration)
+	ttl := pipe.PTTL(r.ctx, key)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return 0, 0, err
+	}
+
+	return incr.Val(), ttl.Val(), nil
+}
+
 func (r *RedisClient) Get(key string, dest interface{}) error {
 	val, err := r.client.Get(r.ctx, key).Result()
 	if err != nil {
@@ -63,8 +87,77 @@ func (r *RedisClient) Get(key string, dest interface{}) error {
 	return json.Unmarshal([]byte(val), dest)
 }
 
-func (r *RedisClient) Delete(key string) error {
-	return r.client.Del(r.ctx, key).Err()
+func (r *RedisClient) HSet(key, field string, value interface{}, expiration time.Duration) error {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.HSet(r.ctx, key, field, jsonValue)
+	pipe.Expire(r.ctx, key, expiration)
+	_, err = pipe.Exec(r.ctx)
+	return err
+}
+
+func (r *RedisClient) HGet(key, field string, dest interface{}) error {
+	val, err := r.client.HGet(r.ctx, key, field).Result()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(val), dest)
+}
+
+func (r *RedisClient) Publish(channel string, value interface{}) error {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(r.ctx, channel, jsonValue).Err()
+}
+
+// Subscribe calls handler with every message published on channel until ctx
+// is done. Dropped connections are re-established by the client.
+func (r *RedisClient) Subscribe(ctx context.Context, channel string, handler func(payload string)) {
+	pubsub := r.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			handler(message.Payload)
+		}
+	}
+}
+
+func (r *RedisClient) Delete(keys ...string) error {
+	return r.client.Del(r.ctx, keys...).Err()
+}
+
+// DeleteMatching deletes every key matching the glob pattern. It walks the
+// keys with SCAN, so Redis is not blocked like with KEYS.
+func (r *RedisClient) DeleteMatching(pattern string) error {
+	var keys []string
+	iter := r.client.Scan(r.ctx, 0, pattern, 100).Iterator()
+	for iter.Next(r.ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return r.client.Del(r.ctx, keys...).Err()
 }
 
 func (r *RedisClient) Exists(key string) bool {
@@ -92,6 +185,30 @@ func (r *RedisClient) GetUserStatsCacheKey(userID int) string {
 	return fmt.Sprintf(keyPattern, userID)
 }
 
+func (r *RedisClient) GetUserAnalyticsCacheKey(userID int) string {
+	keyPattern := getEnv("CACHE_KEY_USER_ANALYTICS", "analytics:user:%d")
+	return fmt.Sprintf(keyPattern, userID)
+}
+
+func (r *RedisClient) GetUserVersionCacheKey(userID int) string {
+	keyPattern := getEnv("CACHE_KEY_USER_VERSION", "version:user:%d")
+	return fmt.Sprintf(keyPattern, userID)
+}
+
+func (r *RedisClient) GetEventsChannel() string {
+	return getEnv("REDIS_EVENTS_CHANNEL", "events:users")
+}
+
+func (r *RedisClient) GetRateLimitKey(key string) string {
+	keyPattern := getEnv("CACHE_KEY_RATE_LIMIT", "ratelimit:%s")
+	return fmt.Sprintf(keyPattern, key)
+}
+
+func (r *RedisClient) GetIdempotencyKey(userID int, key string) string {
+	keyPattern := getEnv("CACHE_KEY_IDEMPOTENCY", "idempotency:user:%d:%s")
+	return fmt.Sprintf(keyPattern, userID, key)
+}
+
 // Helper functions
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
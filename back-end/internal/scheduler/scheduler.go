@@ -2,16 +2,17 @@ package scheduler
 
 import (
 	"log"
-	"os"
 	"time"
 
 	"subscription-tracker/internal/database"
 	"subscription-tracker/internal/email"
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/webhook"
 
 	"github.com/robfig/cron/v3"
 )
 
-func InitScheduler(db *database.DB) {
+func InitScheduler(db *database.DB, bus *events.Bus) {
 	c := cron.New()
 
 	// Check for upcoming subscriptions every day at 12 AM
@@ -20,6 +21,52 @@ func InitScheduler(db *database.DB) {
 		CheckUpcomingSubscriptions(db)
 	})
 
+	// Publish renewal events for webhooks every day at 12 AM
+	c.AddFunc("15 00 * * *", func() {
+		log.Println("Publishing renewal events...")
+		webhook.CheckRenewals(db, bus, time.Now().UTC())
+	})
+
+	// Remove expired idempotency keys every day at 1 AM
+	c.AddFunc("00 01 * * *", func() {
+		deleted, err := db.DeleteExpiredIdempotencyKeys()
+		if err != nil {
+			log.Printf("Failed to delete expired idempotency keys: %v", err)
+			return
+		}
+		log.Printf("Deleted %d expired idempotency keys", deleted)
+	})
+
+	// Remove expired refresh tokens every day at 1:15 AM
+	c.AddFunc("15 01 * * *", func() {
+		deleted, err := db.DeleteExpiredRefreshTokens()
+		if err != nil {
+			log.Printf("Failed to delete expired refresh tokens: %v", err)
+			return
+		}
+		log.Printf("Deleted %d expired refresh tokens", deleted)
+	})
+
+	// Remove used and expired password reset tokens every day at 1:30 AM
+	c.AddFunc("30 01 * * *", func() {
+		deleted, err := db.DeleteExpiredPasswordResetTokens()
+		if err != nil {
+			log.Printf("Failed to delete expired password reset tokens: %v", err)
+			return
+		}
+		log.Printf("Deleted %d expired password reset tokens", deleted)
+	})
+
+	// Remove unfinished passkey ceremonies every day at 1:45 AM
+	c.AddFunc("45 01 * * *", func() {
+		deleted, err := db.DeleteExpiredWebAuthnCeremonies()
+		if err != nil {
+			log.Printf("Failed to delete expired passkey ceremonies: %v", err)
+			return
+		}
+		log.Printf("Deleted %d expired passkey ceremonies", deleted)
+	})
+
 	c.Start()
 	log.Println("Scheduler started")
 }
@@ -34,15 +81,7 @@ func CheckUpcomingSubscriptions(db *database.DB) {
 	// Initialize email service
 	sendInterval := 5 * time.Second
 
-	emailConfig := email.EmailConfig{
-		SMTPHost:     "smtp.gmail.com",
-		SMTPPort:     443,
-		SMTPUser:     os.Getenv("SMTP_USER"),
-		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
-		FromEmail:    os.Getenv("SMTP_FROM"),
-	}
-
-	emailService := email.NewEmailService(emailConfig)
+	emailService := email.NewEmailService(email.ConfigFromEnv())
 
 	for _, sub := range subscriptions {
 		err := emailService.SendSubscriptionAlert(sub)
@@ -0,0 +1,105 @@
+package statement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// ISO 20022 bank-to-customer statement. Only the elements needed to describe a
+// charge are mapped; namespaces are ignored so all camt.053 versions parse.
+type camtDocument struct {
+	Statements []struct {
+		Entries []camtEntry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtEntry struct {
+	Amount struct {
+		Value    string `xml:",chardata"`
+		Currency string `xml:"Ccy,attr"`
+	} `xml:"Amt"`
+	CreditDebit string `xml:"CdtDbtInd"`
+	Status      struct {
+		Value string `xml:",chardata"`
+		Code  string `xml:"Cd"`
+	} `xml:"Sts"`
+	BookingDate struct {
+		Date     string `xml:"Dt"`
+		DateTime string `xml:"DtTm"`
+	} `xml:"BookgDt"`
+	ValueDate struct {
+		Date string `xml:"Dt"`
+	} `xml:"ValDt"`
+	AdditionalInfo string `xml:"AddtlNtryInf"`
+	Details        []struct {
+		Creditor        string `xml:"RltdPties>Cdtr>Nm"`
+		CreditorParty   string `xml:"RltdPties>Cdtr>Pty>Nm"`
+		Unstructured    string `xml:"RmtInf>Ustrd"`
+		AdditionalTxInf string `xml:"AddtlTxInf"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+// ParseCAMT053 reads ISO 20022 camt.053 account statements
+func ParseCAMT053(data []byte) ([]Transaction, error) {
+	var doc camtDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid camt.053 document: %v", err)
+	}
+
+	var transactions []Transaction
+	for _, stmt := range doc.Statements {
+		for _, entry := range stmt.Entries {
+			// Skip pending entries, which may still change or disappear
+			status := strings.TrimSpace(entry.Status.Value + entry.Status.Code)
+			if status == "PDNG" {
+				continue
+			}
+
+			dateValue := entry.BookingDate.Date
+			if dateValue == "" && len(entry.BookingDate.DateTime) >= 10 {
+				dateValue = entry.BookingDate.DateTime[:10]
+			}
+			if dateValue == "" {
+				dateValue = entry.ValueDate.Date
+			}
+			date, err := parseDate(dateValue, "2006-01-02")
+			if err != nil {
+				return nil, err
+			}
+
+			amount, err := parseAmount(entry.Amount.Value)
+			if err != nil {
+				return nil, err
+			}
+			if strings.TrimSpace(entry.CreditDebit) == "DBIT" {
+				amount = -amount
+			}
+
+			transactions = append(transactions, Transaction{
+				Date:        date,
+				Amount:      amount,
+				Currency:    entry.Amount.Currency,
+				Description: camtDescription(entry),
+			})
+		}
+	}
+
+	if transactions == nil {
+		return nil, fmt.Errorf("no entries found in camt.053 document")
+	}
+
+	return transactions, nil
+}
+
+func camtDescription(entry camtEntry) string {
+	for _, details := range entry.Details {
+		for _, value := range []string{details.Creditor, details.CreditorParty, details.Unstructured, details.AdditionalTxInf} {
+			if value = strings.TrimSpace(value); value != "" {
+				return value
+			}
+		}
+	}
+
+	return strings.TrimSpace(entry.AdditionalInfo)
+}
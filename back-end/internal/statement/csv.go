@@ -0,0 +1,163 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Header keywords used to locate columns in bank CSV exports
+var (
+	csvDateColumns        = []string{"booking date", "transaction date", "posted date", "posting date", "date", "value date"}
+	csvAmountColumns      = []string{"amount", "transaction amount"}
+	csvDebitColumns       = []string{"debit", "withdrawal", "money out", "paid out"}
+	csvCreditColumns      = []string{"credit", "deposit", "money in", "paid in"}
+	csvDescriptionColumns = []string{"payee", "merchant", "counterparty", "name", "description", "details", "narrative", "memo", "reference"}
+	csvCurrencyColumns    = []string{"currency", "ccy"}
+)
+
+// ParseCSV reads bank CSV exports with a header row. The delimiter is
+// detected from the header, and amounts may be a single signed column or
+// separate debit and credit columns. Unless dateOrder is given, the order of
+// numeric dates is detected from the whole date column.
+func ParseCSV(data []byte, dateOrder string) ([]Transaction, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+
+	dateColumn := findColumn(header, csvDateColumns)
+	amountColumn := findColumn(header, csvAmountColumns)
+	debitColumn := findColumn(header, csvDebitColumns)
+	creditColumn := findColumn(header, csvCreditColumns)
+	descriptionColumn := findColumn(header, csvDescriptionColumns)
+	currencyColumn := findColumn(header, csvCurrencyColumns)
+
+	if dateColumn < 0 || descriptionColumn < 0 || (amountColumn < 0 && debitColumn < 0) {
+		return nil, fmt.Errorf("CSV needs date, description and amount (or debit) columns")
+	}
+
+	var records [][]string
+	var dates []string
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		records = append(records, record)
+		dates = append(dates, field(record, dateColumn))
+	}
+
+	if dateOrder == "" {
+		dateOrder, err = detectDateOrder(dates)
+		if err != nil {
+			return nil, err
+		}
+	}
+	layouts := dateLayouts(dateOrder)
+
+	var transactions []Transaction
+	for i, record := range records {
+		row := i + 2
+		if dates[i] == "" {
+			continue
+		}
+
+		date, err := parseDate(dates[i], layouts...)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+
+		var amount float64
+		if amountColumn >= 0 {
+			amount, err = parseAmount(field(record, amountColumn))
+		} else {
+			amount, err = debitCreditAmount(field(record, debitColumn), field(record, creditColumn))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+
+		transactions = append(transactions, Transaction{
+			Date:        date,
+			Amount:      amount,
+			Currency:    strings.ToUpper(field(record, currencyColumn)),
+			Description: field(record, descriptionColumn),
+		})
+	}
+
+	if transactions == nil {
+		return nil, fmt.Errorf("no transactions found in CSV file")
+	}
+
+	return transactions, nil
+}
+
+// Helper functions
+func detectDelimiter(data []byte) rune {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+
+	best, count := ',', bytes.Count(line, []byte(","))
+	for _, delimiter := range []rune{';', '\t', '|'} {
+		if c := bytes.Count(line, []byte(string(delimiter))); c > count {
+			best, count = delimiter, c
+		}
+	}
+	return best
+}
+
+// findColumn returns the first header matching a keyword, preferring keywords
+// earlier in the list, or -1
+func findColumn(header []string, keywords []string) int {
+	for _, keyword := range keywords {
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), keyword) {
+				return i
+			}
+		}
+	}
+	for _, keyword := range keywords {
+		for i, column := range header {
+			if strings.Contains(strings.ToLower(column), keyword) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func field(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+func debitCreditAmount(debit, credit string) (float64, error) {
+	if debit != "" {
+		amount, err := parseAmount(debit)
+		if amount > 0 {
+			amount = -amount
+		}
+		return amount, err
+	}
+	if credit != "" {
+		return parseAmount(credit)
+	}
+	return 0, fmt.Errorf("row has neither debit nor credit amount")
+}
@@ -0,0 +1,79 @@
+package statement
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ofxTransactionPattern = regexp.MustCompile(`(?is)<STMTTRN>(.*?)(?:</STMTTRN>|<STMTTRN>|</BANKTRANLIST>)`)
+	ofxCurrencyPattern    = regexp.MustCompile(`(?i)<CURDEF>\s*([A-Z]{3})`)
+)
+
+// ParseOFX reads OFX and QFX files. Both the SGML (1.x) variant, where
+// elements are not closed, and the XML (2.x) variant are supported.
+func ParseOFX(data []byte) ([]Transaction, error) {
+	content := string(data)
+
+	currency := ""
+	if match := ofxCurrencyPattern.FindStringSubmatch(content); match != nil {
+		currency = strings.ToUpper(match[1])
+	}
+
+	// Blocks are matched one at a time because an unclosed SGML block ends
+	// where the next one starts
+	var transactions []Transaction
+	for offset := 0; offset < len(content); {
+		loc := ofxTransactionPattern.FindStringSubmatchIndex(content[offset:])
+		if loc == nil {
+			break
+		}
+		block := content[offset+loc[2] : offset+loc[3]]
+		offset += loc[3]
+
+		posted := ofxElement(block, "DTPOSTED")
+		if len(posted) < 8 {
+			return nil, fmt.Errorf("transaction without a valid DTPOSTED")
+		}
+		date, err := parseDate(posted[:8], "20060102")
+		if err != nil {
+			return nil, err
+		}
+
+		amount, err := parseAmount(ofxElement(block, "TRNAMT"))
+		if err != nil {
+			return nil, err
+		}
+
+		description := ofxElement(block, "NAME")
+		if memo := ofxElement(block, "MEMO"); description == "" {
+			description = memo
+		}
+
+		transactions = append(transactions, Transaction{
+			Date:        date,
+			Amount:      amount,
+			Currency:    currency,
+			Description: description,
+		})
+	}
+
+	if transactions == nil {
+		return nil, fmt.Errorf("no transactions found in OFX file")
+	}
+
+	return transactions, nil
+}
+
+func ofxElement(block, name string) string {
+	pattern := regexp.MustCompile(`(?i)<` + name + `>([^<\r\n]*)`)
+	match := pattern.FindStringSubmatch(block)
+	if match == nil {
+		return ""
+	}
+
+	value := strings.TrimSpace(match[1])
+	value = strings.ReplaceAll(value, "&amp;", "&")
+	return value
+}
@@ -0,0 +1,67 @@
+package statement
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ParseQIF reads Quicken Interchange Format files. Each record is a list of
+// lines prefixed with a field code and terminated by "^".
+func ParseQIF(data []byte) ([]Transaction, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	var transactions []Transaction
+	var current Transaction
+	var payee, memo string
+	hasDate := false
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "!") {
+			continue
+		}
+
+		code, value := text[0], strings.TrimSpace(text[1:])
+		switch code {
+		case 'D':
+			// Quicken writes years after 1999 as MM/DD'YY
+			date, err := parseDate(strings.ReplaceAll(value, "'", "/"),
+				"01/02/2006", "1/2/2006", "01/02/06", "1/2/06", "2006-01-02", "02.01.2006")
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			current.Date = date
+			hasDate = true
+		case 'T', 'U':
+			amount, err := parseAmount(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			current.Amount = amount
+		case 'P':
+			payee = value
+		case 'M':
+			memo = value
+		case '^':
+			if hasDate {
+				current.Description = payee
+				if current.Description == "" {
+					current.Description = memo
+				}
+				transactions = append(transactions, current)
+			}
+			current, payee, memo, hasDate = Transaction{}, "", "", false
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if transactions == nil {
+		return nil, fmt.Errorf("no transactions found in QIF file")
+	}
+
+	return transactions, nil
+}
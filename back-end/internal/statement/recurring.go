@@ -0,0 +1,255 @@
+package statement
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"subscription-tracker/internal/billing"
+	"subscription-tracker/internal/models"
+)
+
+// DetectOptions tunes recurring-charge detection
+type DetectOptions struct {
+	// AmountTolerance is the relative deviation from the median amount that
+	// still counts as the same charge, e.g. 0.1 for 10%
+	AmountTolerance float64
+	// MinConfidence drops candidates scoring below it
+	MinConfidence float64
+	// Today moves suggested next billing dates out of the past
+	Today time.Time
+}
+
+type cycleWindow struct {
+	cycle    string
+	days     float64
+	min, max float64
+	// intervals needed before the count stops lowering confidence
+	wantIntervals int
+}
+
+var cycleWindows = []cycleWindow{
+	{billing.CycleWeekly, 7, 5, 9, 4},
+	{billing.CycleMonthly, 30.44, 25, 36, 3},
+	{billing.CycleYearly, 365.25, 350, 380, 2},
+}
+
+// Prefixes banks and payment processors put in front of card and direct debit
+// descriptions
+var merchantPrefixes = []string{
+	"debit card purchase ", "card purchase ", "pos purchase ", "recurring payment ",
+	"direct debit ", "purchase ", "payment to ", "pos ", "dd ", "sq *", "tst*", "paypal *", "pp*",
+}
+
+// Tokens that carry no information about the merchant
+var merchantNoise = map[string]bool{
+	"www": true, "com": true, "net": true, "inc": true, "ltd": true, "llc": true,
+	"gmbh": true, "bv": true, "sarl": true, "co": true, "the": true, "bill": true, "help": true,
+}
+
+// NormalizeMerchant reduces a statement description to a stable merchant key,
+// so that "NETFLIX.COM 866-579-7172 CA" and "Netflix.com 31/05" group together.
+// Names with digits such as "1Password" or "O2" are kept.
+func NormalizeMerchant(description string) string {
+	value := strings.ToLower(strings.TrimSpace(description))
+	for _, prefix := range merchantPrefixes {
+		value = strings.TrimSpace(strings.TrimPrefix(value, prefix))
+	}
+
+	var tokens []string
+	for _, token := range strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if merchantNoise[token] || len(token) < 2 || isReference(token) {
+			continue
+		}
+		tokens = append(tokens, token)
+		if len(tokens) == 2 {
+			break
+		}
+	}
+
+	return strings.Join(tokens, " ")
+}
+
+// DetectRecurring groups outgoing transactions by merchant and returns the
+// groups that repeat on a weekly, monthly or yearly schedule, most confident
+// first
+func DetectRecurring(transactions []Transaction, opts DetectOptions) []models.RecurringCandidate {
+	groups := map[string][]Transaction{}
+	var statementEnd time.Time
+	for _, txn := range transactions {
+		if txn.Date.After(statementEnd) {
+			statementEnd = txn.Date
+		}
+		if txn.Amount >= 0 {
+			continue
+		}
+
+		key := NormalizeMerchant(txn.Description)
+		if key == "" {
+			continue
+		}
+		groups[key] = append(groups[key], txn)
+	}
+
+	candidates := []models.RecurringCandidate{}
+	for key, group := range groups {
+		candidate, ok := scoreGroup(key, group, statementEnd, opts)
+		if ok && candidate.Confidence >= opts.MinConfidence {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Confidence != candidates[j].Confidence {
+			return candidates[i].Confidence > candidates[j].Confidence
+		}
+		return candidates[i].NormalizedName < candidates[j].NormalizedName
+	})
+
+	return candidates
+}
+
+// scoreGroup rates how likely a merchant group is a subscription, combining
+// interval regularity, amount stability, number of charges and whether the
+// last charge is recent relative to the end of the statement
+func scoreGroup(key string, group []Transaction, statementEnd time.Time, opts DetectOptions) (models.RecurringCandidate, bool) {
+	if len(group) < 2 {
+		return models.RecurringCandidate{}, false
+	}
+
+	sort.Slice(group, func(i, j int) bool { return group[i].Date.Before(group[j].Date) })
+
+	intervals := make([]float64, 0, len(group)-1)
+	for i := 1; i < len(group); i++ {
+		days := group[i].Date.Sub(group[i-1].Date).Hours() / 24
+		// Same-day repeats are usually split or retried payments
+		if days >= 1 {
+			intervals = append(intervals, days)
+		}
+	}
+	if len(intervals) == 0 {
+		return models.RecurringCandidate{}, false
+	}
+
+	var window *cycleWindow
+	typical := median(intervals)
+	for i := range cycleWindows {
+		if typical >= cycleWindows[i].min && typical <= cycleWindows[i].max {
+			window = &cycleWindows[i]
+			break
+		}
+	}
+	if window == nil {
+		return models.RecurringCandidate{}, false
+	}
+
+	regular := 0
+	for _, days := range intervals {
+		if days >= window.min && days <= window.max {
+			regular++
+		}
+	}
+	intervalScore := float64(regular) / float64(len(intervals))
+
+	amounts := make([]float64, len(group))
+	for i, txn := range group {
+		amounts[i] = -txn.Amount
+	}
+	typicalAmount := median(amounts)
+	stable := 0
+	for _, amount := range amounts {
+		if math.Abs(amount-typicalAmount) <= opts.AmountTolerance*typicalAmount {
+			stable++
+		}
+	}
+	amountScore := float64(stable) / float64(len(amounts))
+
+	countScore := math.Min(1, float64(len(intervals))/float64(window.wantIntervals))
+
+	last := group[len(group)-1]
+	recencyScore := 0.0
+	if statementEnd.Sub(last.Date).Hours()/24 <= window.days*1.5 {
+		recencyScore = 1
+	}
+
+	confidence := 0.4*intervalScore + 0.3*amountScore + 0.15*countScore + 0.15*recencyScore
+
+	next := billing.AddCycles(last.Date, window.cycle, 1)
+	for n := 2; !opts.Today.IsZero() && next.Before(billing.Day(opts.Today)); n++ {
+		next = billing.AddCycles(last.Date, window.cycle, n)
+	}
+
+	name := titleCase(key)
+	price := math.Round(-last.Amount*100) / 100
+
+	return models.RecurringCandidate{
+		Merchant:       mostCommonDescription(group),
+		NormalizedName: key,
+		BillingCycle:   window.cycle,
+		Amount:         price,
+		Currency:       last.Currency,
+		Occurrences:    len(group),
+		FirstSeen:      group[0].Date.Format("2006-01-02"),
+		LastSeen:       last.Date.Format("2006-01-02"),
+		Confidence:     math.Round(confidence*100) / 100,
+		Subscription: models.CreateSubscriptionRequest{
+			Name:            name,
+			Price:           price,
+			Category:        "Other",
+			BillingCycle:    window.cycle,
+			NextBillingDate: next.Format("2006-01-02"),
+		},
+	}, true
+}
+
+// Helper functions
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+func mostCommonDescription(group []Transaction) string {
+	counts := map[string]int{}
+	best := ""
+	for _, txn := range group {
+		counts[txn.Description]++
+		if counts[txn.Description] > counts[best] || (counts[txn.Description] == counts[best] && txn.Description < best) {
+			best = txn.Description
+		}
+	}
+	return best
+}
+
+func titleCase(value string) string {
+	words := strings.Fields(value)
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// isReference reports whether a token is a number or looks like a card,
+// transaction or phone reference rather than part of a name
+func isReference(token string) bool {
+	digits, letters := 0, 0
+	for _, r := range token {
+		if unicode.IsDigit(r) {
+			digits++
+		} else {
+			letters++
+		}
+	}
+	return letters == 0 || digits >= 4 || digits > letters
+}
@@ -0,0 +1,189 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported statement formats
+const (
+	FormatOFX     = "ofx"
+	FormatQIF     = "qif"
+	FormatCAMT053 = "camt053"
+	FormatCSV     = "csv"
+)
+
+// Orders of day and month in numeric dates such as 05/03/2024
+const (
+	DateOrderDayFirst   = "dmy"
+	DateOrderMonthFirst = "mdy"
+)
+
+// Transaction is a single booked statement line. Amount is negative for money
+// leaving the account.
+type Transaction struct {
+	Date        time.Time
+	Amount      float64
+	Currency    string
+	Description string
+}
+
+// DetectFormat guesses the statement format from its content
+func DetectFormat(data []byte) string {
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	upper := bytes.ToUpper(head)
+
+	switch {
+	case bytes.Contains(upper, []byte("OFXHEADER")) || bytes.Contains(upper, []byte("<OFX>")):
+		return FormatOFX
+	case bytes.Contains(head, []byte("camt.053")) || bytes.Contains(head, []byte("BkToCstmrStmt")):
+		return FormatCAMT053
+	case bytes.HasPrefix(bytes.TrimSpace(upper), []byte("!TYPE:")) || bytes.HasPrefix(bytes.TrimSpace(upper), []byte("!ACCOUNT")):
+		return FormatQIF
+	default:
+		return FormatCSV
+	}
+}
+
+// Parse reads all transactions of a statement in the given format. dateOrder
+// sets the order of numeric CSV dates, which is detected from the whole file
+// when empty.
+func Parse(format string, data []byte, dateOrder string) ([]Transaction, error) {
+	switch format {
+	case FormatOFX, "qfx":
+		return ParseOFX(data)
+	case FormatQIF:
+		return ParseQIF(data)
+	case FormatCAMT053:
+		return ParseCAMT053(data)
+	case FormatCSV:
+		return ParseCSV(data, dateOrder)
+	default:
+		return nil, fmt.Errorf("unsupported statement format %q", format)
+	}
+}
+
+// Helper functions
+
+var numericDate = regexp.MustCompile(`^(\d{1,2})([/.-])(\d{1,2})[/.-](\d{2}|\d{4})$`)
+
+// detectDateOrder decides once for a column of dates whether numeric dates
+// are day-first or month-first, so every row is read the same way. A first
+// field above 12 means day-first and a second field above 12 month-first.
+// Dotted dates are day-first by convention.
+func detectDateOrder(values []string) (string, error) {
+	dayFirst, monthFirst := false, false
+	ambiguous := ""
+	for _, value := range values {
+		match := numericDate.FindStringSubmatch(strings.TrimSpace(value))
+		if match == nil {
+			continue
+		}
+
+		first, _ := strconv.Atoi(match[1])
+		second, _ := strconv.Atoi(match[3])
+		switch {
+		case first > 12:
+			dayFirst = true
+		case second > 12:
+			monthFirst = true
+		case match[2] == ".":
+			dayFirst = true
+		case first != second && ambiguous == "":
+			ambiguous = value
+		}
+	}
+
+	switch {
+	case dayFirst && monthFirst:
+		return "", fmt.Errorf("dates mix day-first and month-first order")
+	case dayFirst:
+		return DateOrderDayFirst, nil
+	case monthFirst, ambiguous == "":
+		return DateOrderMonthFirst, nil
+	default:
+		return "", fmt.Errorf("dates such as %q could be day-first or month-first, set dateOrder to dmy or mdy", ambiguous)
+	}
+}
+
+// dateLayouts returns the date layouts commonly found in bank exports, with
+// numeric dates read in the given order
+func dateLayouts(order string) []string {
+	numeric := []string{"01/02/2006", "1/2/2006", "01/02/06", "1/2/06", "01-02-2006", "1-2-2006", "01.02.2006", "1.2.2006"}
+	if order == DateOrderDayFirst {
+		numeric = []string{"02/01/2006", "2/1/2006", "02/01/06", "2/1/06", "02-01-2006", "2-1-2006", "02.01.2006", "2.1.2006"}
+	}
+
+	layouts := []string{
+		"2006-01-02",
+		"2006-01-02T15:04:05",
+		time.RFC3339,
+		"2006/01/02",
+		"20060102",
+		"Jan 2, 2006",
+		"2 Jan 2006",
+		"02 Jan 2006",
+	}
+	return append(layouts, numeric...)
+}
+
+// parseDate tries each layout in turn
+func parseDate(value string, layouts ...string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+// parseAmount accepts both 1,234.56 and 1.234,56 style numbers and a leading
+// currency symbol or trailing minus sign
+func parseAmount(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	value = strings.Trim(value, "$€£¥₮ ")
+	if value == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = strings.Trim(value, "()")
+	}
+	if strings.HasSuffix(value, "-") {
+		negative = true
+		value = strings.TrimSuffix(value, "-")
+	}
+	value = strings.Trim(value, "$€£¥₮ ")
+
+	lastComma := strings.LastIndex(value, ",")
+	lastDot := strings.LastIndex(value, ".")
+	if lastComma > lastDot {
+		// Decimal comma: drop thousands dots and swap the separator
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.Replace(value, ",", ".", 1)
+	} else {
+		value = strings.ReplaceAll(value, ",", "")
+	}
+	value = strings.ReplaceAll(value, " ", "")
+
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return amount, nil
+}
@@ -0,0 +1,63 @@
+package statement
+
+import "testing"
+
+// TestParseCSVDateOrder reads every date of a file in the same order
+func TestParseCSVDateOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		dates     []string
+		dateOrder string
+		want      []string // YYYY-MM-DD, or nil when the file is rejected
+	}{
+		{"day-first", []string{"05/03/2024", "15/03/2024"}, "", []string{"2024-03-05", "2024-03-15"}},
+		{"month-first", []string{"03/05/2024", "03/15/2024"}, "", []string{"2024-03-05", "2024-03-15"}},
+		{"dotted", []string{"05.03.2024"}, "", []string{"2024-03-05"}},
+		{"ambiguous", []string{"05/03/2024", "06/04/2024"}, "", nil},
+		{"ambiguous with order", []string{"05/03/2024", "06/04/2024"}, DateOrderDayFirst, []string{"2024-03-05", "2024-04-06"}},
+		{"mixed", []string{"15/03/2024", "03/15/2024"}, "", nil},
+		{"iso", []string{"2024-03-05"}, "", []string{"2024-03-05"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csv := "Date,Description,Amount\n"
+			for _, date := range tt.dates {
+				csv += date + ",Netflix,-9.99\n"
+			}
+
+			transactions, err := ParseCSV([]byte(csv), tt.dateOrder)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("expected the file to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, txn := range transactions {
+				if got := txn.Date.Format("2006-01-02"); got != tt.want[i] {
+					t.Errorf("row %d: got %s, want %s", i+2, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeMerchant(t *testing.T) {
+	tests := map[string]string{
+		"NETFLIX.COM 866-579-7172 CA":      "netflix ca",
+		"Netflix.com 31/05":                "netflix",
+		"1Password":                        "1password",
+		"O2 UK Direct Debit":               "o2 uk",
+		"Card purchase SPOTIFY P1A2B3C4D5": "spotify",
+		"AMZN Prime x1234":                 "amzn prime",
+	}
+
+	for description, want := range tests {
+		if got := NormalizeMerchant(description); got != want {
+			t.Errorf("NormalizeMerchant(%q) = %q, want %q", description, got, want)
+		}
+	}
+}
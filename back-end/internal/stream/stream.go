@@ -0,0 +1,195 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/redis"
+	"subscription-tracker/internal/utils"
+)
+
+// StatsChanged is sent next to every subscription event, since each of them
+// changes the user's stats
+const StatsChanged = "stats.changed"
+
+const (
+	// MaxStreamsPerUser bounds the open streams of one user on one instance
+	MaxStreamsPerUser = 10
+
+	// Messages buffered per stream. A client that falls this far behind is
+	// disconnected and catches up by reconnecting.
+	streamBuffer = 32
+)
+
+var ErrTooManyStreams = errors.New("too many open event streams")
+
+// Message is one event sent to a user's open streams
+type Message struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	UserID     int             `json:"-"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	OccurredAt time.Time       `json:"occurredAt"`
+}
+
+// envelope is a message as published on Redis, where the user is needed to
+// route it
+type envelope struct {
+	Message
+	UserID int `json:"userId"`
+}
+
+// Hub fans events out to the open streams of each user. With Redis, messages
+// go through pub/sub so streams on every instance receive them; without it
+// they are delivered in process.
+type Hub struct {
+	redisClient *redis.RedisClient
+	mu          sync.Mutex
+	streams     map[int]map[chan Message]struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+func NewHub(redisClient *redis.RedisClient) *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Hub{
+		redisClient: redisClient,
+		streams:     map[int]map[chan Message]struct{}{},
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+func (h *Hub) Start() {
+	if h.redisClient == nil {
+		log.Println("Starting event streams with in-process delivery...")
+		return
+	}
+
+	log.Println("Starting event streams with Redis pub/sub...")
+	go h.redisClient.Subscribe(h.ctx, h.redisClient.GetEventsChannel(), func(payload string) {
+		var message envelope
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			log.Printf("Dropping malformed stream message: %v", err)
+			return
+		}
+		message.Message.UserID = message.UserID
+		h.deliver(message.Message)
+	})
+}
+
+// Stop closes every open stream
+func (h *Hub) Stop() {
+	h.cancel()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userID, streams := range h.streams {
+		for messages := range streams {
+			close(messages)
+		}
+		delete(h.streams, userID)
+	}
+	log.Println("Event streams stopped")
+}
+
+// Handle publishes event to the user's streams. It is meant to be registered
+// with events.Bus.Subscribe.
+func (h *Hub) Handle(event events.Event) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		log.Printf("Failed to encode stream event %s: %v", event.Type, err)
+		return
+	}
+
+	h.publish(Message{Type: event.Type, UserID: event.UserID, Data: data, OccurredAt: event.OccurredAt})
+	if strings.HasPrefix(event.Type, "subscription.") {
+		h.publish(Message{Type: StatsChanged, UserID: event.UserID, OccurredAt: event.OccurredAt})
+	}
+}
+
+// Subscribe opens a stream for the user. The returned channel is closed when
+// the client falls behind or the hub stops; close must be called once the
+// client is gone.
+func (h *Hub) Subscribe(userID int) (<-chan Message, func(), error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.streams[userID]) >= MaxStreamsPerUser {
+		return nil, nil, ErrTooManyStreams
+	}
+	if h.ctx.Err() != nil {
+		return nil, nil, h.ctx.Err()
+	}
+
+	messages := make(chan Message, streamBuffer)
+	if h.streams[userID] == nil {
+		h.streams[userID] = map[chan Message]struct{}{}
+	}
+	h.streams[userID][messages] = struct{}{}
+
+	return messages, func() { h.remove(userID, messages) }, nil
+}
+
+// Helper functions
+func (h *Hub) publish(message Message) {
+	id, err := utils.GenerateSecureToken()
+	if err != nil {
+		log.Printf("Failed to generate stream message ID: %v", err)
+		return
+	}
+	message.ID = "msg_" + id[:24]
+
+	if h.redisClient != nil {
+		err := h.redisClient.Publish(h.redisClient.GetEventsChannel(), envelope{Message: message, UserID: message.UserID})
+		if err == nil {
+			return
+		}
+		// Streams on this instance still get the message
+		log.Printf("Failed to publish stream message, delivering locally: %v", err)
+	}
+
+	h.deliver(message)
+}
+
+func (h *Hub) deliver(message Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for messages := range h.streams[message.UserID] {
+		select {
+		case messages <- message:
+		default:
+			log.Printf("Closing event stream of user %d that fell behind", message.UserID)
+			h.removeLocked(message.UserID, messages)
+		}
+	}
+}
+
+func (h *Hub) remove(userID int, messages chan Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(userID, messages)
+}
+
+func (h *Hub) removeLocked(userID int, messages chan Message) {
+	streams, ok := h.streams[userID]
+	if !ok {
+		return
+	}
+	if _, ok := streams[messages]; !ok {
+		return
+	}
+
+	close(messages)
+	delete(streams, messages)
+	if len(streams) == 0 {
+		delete(h.streams, userID)
+	}
+}
@@ -13,11 +13,27 @@ import (
 var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    int    `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID int    `json:"sid"`
+	Purpose   string `json:"purpose,omitempty"` // set on single-purpose tokens, which are not access tokens
+	NewEmail  string `json:"new_email,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Purposes of tokens that are sent to the user rather than used for access
+const (
+	PurposeVerifyEmail = "verify_email"
+	PurposeChangeEmail = "change_email"
+
+	// PurposeLoginChallenge marks a sign-in that still needs its second factor
+	PurposeLoginChallenge = "login_challenge"
+
+	// PurposeEventStream marks a token that opens the event stream of one
+	// session, for clients that can't send an Authorization header
+	PurposeEventStream = "event_stream"
+)
+
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
@@ -28,12 +44,14 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func GenerateRefreshJWT(user models.User) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour * 90) // 90 days
+// GenerateJWT issues an access token for the user's session
+func GenerateJWT(user models.User, sessionID int) (string, error) {
+	expirationTime := time.Now().Add(5 * time.Minute) // Token expires in 5 minutes
 
 	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
+		UserID:    user.ID,
+		Email:     user.Email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -46,25 +64,63 @@ func GenerateRefreshJWT(user models.User) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
-func GenerateJWT(user models.User) (string, error) {
-	expirationTime := time.Now().Add(5 * time.Minute) // Token expires in 5 minutes
+// GeneratePurposeJWT issues a token that only proves control of email for
+// one purpose. It stops validating once the user's email changes.
+func GeneratePurposeJWT(userID int, email string, purpose string, ttl time.Duration) (string, error) {
+	return signPurposeJWT(&Claims{UserID: userID, Email: email, Purpose: purpose}, ttl)
+}
 
-	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "subscription-tracker",
-		},
+// GenerateEmailChangeJWT issues a token that moves the account from email to
+// newEmail once the owner of newEmail confirms it
+func GenerateEmailChangeJWT(userID int, email string, newEmail string, ttl time.Duration) (string, error) {
+	return signPurposeJWT(&Claims{UserID: userID, Email: email, Purpose: PurposeChangeEmail, NewEmail: newEmail}, ttl)
+}
+
+// GenerateStreamJWT issues a token that only opens the event stream, for the
+// user's session
+func GenerateStreamJWT(user models.User, sessionID int, ttl time.Duration) (string, error) {
+	return signPurposeJWT(&Claims{UserID: user.ID, Email: user.Email, SessionID: sessionID, Purpose: PurposeEventStream}, ttl)
+}
+
+// ValidatePurposeJWT validates a token issued by GeneratePurposeJWT for purpose
+func ValidatePurposeJWT(tokenString string, purpose string) (*Claims, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("token is not valid for %s", purpose)
+	}
+
+	return claims, nil
+}
+
+// ValidateJWT validates an access token
+func ValidateJWT(tokenString string) (*Claims, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("%s token is not an access token", claims.Purpose)
+	}
+
+	return claims, nil
+}
+
+func signPurposeJWT(claims *Claims, ttl time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		NotBefore: jwt.NewNumericDate(time.Now()),
+		Issuer:    "subscription-tracker",
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
 }
 
-func ValidateJWT(tokenString string) (*Claims, error) {
+func parseJWT(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// GenerateSecureToken returns a random URL-safe token with 256 bits of entropy
+func GenerateSecureToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 digest of a token. Tokens are only
+// stored hashed so that a database leak does not expose usable secrets.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// recoveryCodeAlphabet is Crockford's base32, which leaves out letters that
+// are easy to misread. Its 32 symbols keep every byte mapping unbiased.
+const recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// GenerateRecoveryCode returns a random one-time code with 50 bits of
+// entropy, formatted as xxxxx-xxxxx
+func GenerateRecoveryCode() (string, error) {
+	bytes := make([]byte, 10)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, 11)
+	for i, b := range bytes {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[b&31])
+	}
+
+	return string(code), nil
+}
+
+// NormalizeRecoveryCode drops case, spaces and dashes and reads misread
+// letters the way Crockford's base32 does, so a code matches however it was
+// typed
+func NormalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "", "i", "1", "l", "1", "o", "0").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
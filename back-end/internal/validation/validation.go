@@ -0,0 +1,173 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"subscription-tracker/internal/models"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores everything past 72 bytes
+)
+
+var (
+	validate    = newValidator()
+	slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// Struct checks v against its validate tags and returns one FieldError per
+// failed rule. Field names are the JSON names, so they match the request body.
+func Struct(v interface{}) []models.FieldError {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []models.FieldError{{Code: "invalid", Message: err.Error()}}
+	}
+
+	fieldErrors := make([]models.FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		fieldErrors = append(fieldErrors, models.FieldError{
+			Field:   fieldPath(fieldError.Namespace()),
+			Code:    fieldError.Tag(),
+			Message: message(fieldError),
+		})
+	}
+
+	return fieldErrors
+}
+
+// Messages flattens field errors into "field: message" strings for responses
+// that report errors per row or per operation
+func Messages(fieldErrors []models.FieldError) []string {
+	messages := make([]string, 0, len(fieldErrors))
+	for _, fieldError := range fieldErrors {
+		if fieldError.Field == "" {
+			messages = append(messages, fieldError.Message)
+			continue
+		}
+		messages = append(messages, fieldError.Field+": "+fieldError.Message)
+	}
+	return messages
+}
+
+// IsDate reports whether value is a YYYY-MM-DD or RFC 3339 date
+func IsDate(value string) bool {
+	if _, err := time.Parse("2006-01-02", value); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, value)
+	return err == nil
+}
+
+// Helper functions
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	v.RegisterValidation("date", func(fl validator.FieldLevel) bool {
+		return IsDate(fl.Field().String())
+	})
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return isStrongPassword(fl.Field().String())
+	})
+	v.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+		return slugPattern.MatchString(fl.Field().String())
+	})
+
+	return v
+}
+
+func isStrongPassword(password string) bool {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return false
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+
+	return hasLetter && hasDigit
+}
+
+// fieldPath drops the struct name the validator puts in front of every
+// namespace, e.g. "CatalogService.plans[0].price" becomes "plans[0].price"
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func message(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required", "notblank":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "date":
+		return "must be a date in YYYY-MM-DD format"
+	case "password":
+		return fmt.Sprintf("must be %d to %d characters and contain at least one letter and one digit", minPasswordLength, maxPasswordLength)
+	case "slug":
+		return "must contain only lowercase letters, digits and dashes"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fieldError.Param(), " ", ", ")
+	case "gt":
+		return "must be greater than " + fieldError.Param()
+	case "gte":
+		return "must be at least " + fieldError.Param()
+	case "lt":
+		return "must be less than " + fieldError.Param()
+	case "lte":
+		return "must be at most " + fieldError.Param()
+	case "len":
+		if fieldError.Kind() == reflect.String {
+			return "must be exactly " + fieldError.Param() + " characters"
+		}
+		return "must have exactly " + fieldError.Param() + " items"
+	case "min":
+		if fieldError.Kind() == reflect.String {
+			return "must be at least " + fieldError.Param() + " characters"
+		}
+		return "must have at least " + fieldError.Param() + " items"
+	case "max":
+		if fieldError.Kind() == reflect.String {
+			return "must be at most " + fieldError.Param() + " characters"
+		}
+		return "must have at most " + fieldError.Param() + " items"
+	default:
+		return "is invalid"
+	}
+}
@@ -0,0 +1,344 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"subscription-tracker/internal/billing"
+	"subscription-tracker/internal/events"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/utils"
+)
+
+// Request headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	EventIDHeader   = "X-Webhook-Event-Id"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is failed.
+	// With the backoff below the last retry happens about 4 hours after the
+	// first attempt.
+	MaxAttempts = 10
+
+	baseRetryDelay = 30 * time.Second
+	maxRetryDelay  = 4 * time.Hour
+
+	requestTimeout = 10 * time.Second
+	pollInterval   = 15 * time.Second
+	claimBatchSize = 20
+	claimLease     = 2 * time.Minute
+
+	// ReminderLeadDays matches the lead time of the reminder emails
+	ReminderLeadDays = 3
+
+	// DeliveryRetention is how long finished deliveries stay in the log
+	DeliveryRetention = 30 * 24 * time.Hour
+)
+
+// Sign returns the value of the signature header for a body sent at
+// timestamp: "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". The
+// timestamp is part of the signed content so receivers can reject replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// RetryDelay returns the wait before the next attempt after attempts failures
+func RetryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+// Dispatcher turns events into queued deliveries and sends them in the
+// background. Deliveries live in the database, so pending retries survive
+// restarts and several instances can share the queue.
+type Dispatcher struct {
+	db     models.Database
+	client *http.Client
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewDispatcher(db models.Database) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		db:     db,
+		client: newHTTPClient(os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"),
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (d *Dispatcher) Start() {
+	log.Println("Starting webhook dispatcher...")
+	go d.run()
+}
+
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	log.Println("Webhook dispatcher stopped")
+}
+
+// Handle queues a delivery of event to each of the user's webhooks that
+// subscribed to it. It is meant to be registered with events.Bus.Subscribe.
+func (d *Dispatcher) Handle(event events.Event) {
+	webhooks, err := d.db.GetWebhooksForEvent(event.UserID, event.Type)
+	if err != nil {
+		log.Printf("Failed to load webhooks for %s: %v", event.Type, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	eventID, err := utils.GenerateSecureToken()
+	if err != nil {
+		log.Printf("Failed to generate webhook event ID: %v", err)
+		return
+	}
+	eventID = "evt_" + eventID[:24]
+
+	payload, err := json.Marshal(models.WebhookEvent{
+		ID:        eventID,
+		Type:      event.Type,
+		CreatedAt: event.OccurredAt,
+		Data:      event.Data,
+	})
+	if err != nil {
+		log.Printf("Failed to encode webhook event %s: %v", event.Type, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		err := d.db.CreateWebhookDelivery(models.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   eventID,
+			Event:     event.Type,
+			Payload:   payload,
+		})
+		if err != nil {
+			log.Printf("Failed to queue webhook delivery for webhook %d: %v", webhook.ID, err)
+		}
+	}
+
+	d.Wake()
+}
+
+// Wake makes the dispatcher look for due deliveries without waiting for the
+// next poll
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// CheckRenewals publishes renewal.charged for subscriptions billed today and
+// renewal.upcoming for those billed ReminderLeadDays from today. It runs once
+// a day from the scheduler.
+func CheckRenewals(db models.Database, bus *events.Bus, now time.Time) {
+	subscriptions, err := db.GetSubscriptionsWithWebhooks()
+	if err != nil {
+		log.Printf("Error fetching subscriptions for renewal webhooks: %v", err)
+		return
+	}
+
+	today := billing.Day(now)
+	upcoming := today.AddDate(0, 0, ReminderLeadDays)
+
+	for _, sub := range subscriptions {
+		if len(billing.Occurrences(sub.NextBillingDate, sub.BillingCycle, today, today)) > 0 {
+			bus.Publish(events.RenewalCharged, sub.UserID, models.RenewalEvent{
+				Subscription: sub,
+				Date:         today.Format("2006-01-02"),
+				Amount:       sub.Price,
+			})
+		}
+		if len(billing.Occurrences(sub.NextBillingDate, sub.BillingCycle, upcoming, upcoming)) > 0 {
+			bus.Publish(events.RenewalUpcoming, sub.UserID, models.RenewalEvent{
+				Subscription: sub,
+				Date:         upcoming.Format("2006-01-02"),
+				Amount:       sub.Price,
+			})
+		}
+	}
+
+	deleted, err := db.DeleteWebhookDeliveriesOlderThan(DeliveryRetention)
+	if err != nil {
+		log.Printf("Failed to prune webhook deliveries: %v", err)
+	} else if deleted > 0 {
+		log.Printf("Pruned %d old webhook deliveries", deleted)
+	}
+}
+
+// Helper functions
+func (d *Dispatcher) run() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue()
+
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) deliverDue() {
+	for {
+		deliveries, err := d.db.ClaimDueWebhookDeliveries(claimBatchSize, claimLease)
+		if err != nil {
+			log.Printf("Failed to claim webhook deliveries: %v", err)
+			return
+		}
+
+		for _, delivery := range deliveries {
+			if d.ctx.Err() != nil {
+				return
+			}
+
+			attempt := d.attempt(delivery)
+			if err := d.db.RecordWebhookAttempt(delivery.ID, attempt); err != nil {
+				log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+			}
+		}
+
+		if len(deliveries) < claimBatchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(delivery models.WebhookDelivery) models.WebhookAttempt {
+	statusCode, err := d.send(delivery)
+	if err == nil {
+		return models.WebhookAttempt{Status: models.DeliverySucceeded, ResponseStatus: statusCode}
+	}
+
+	attempt := models.WebhookAttempt{
+		Status:         models.DeliveryFailed,
+		ResponseStatus: statusCode,
+		Error:          err.Error(),
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts < MaxAttempts {
+		attempt.Status = models.DeliveryPending
+		attempt.RetryIn = RetryDelay(attempts)
+	}
+
+	return attempt
+}
+
+func (d *Dispatcher) send(delivery models.WebhookDelivery) (*int, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SubscriptionTracker-Webhooks/1.0")
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, time.Now().Unix(), delivery.Payload))
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(EventIDHeader, delivery.EventID)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	statusCode := resp.StatusCode
+	if statusCode < 200 || statusCode > 299 {
+		return &statusCode, fmt.Errorf("endpoint responded with %d", statusCode)
+	}
+
+	return &statusCode, nil
+}
+
+var errPrivateAddress = errors.New("webhook address is not publicly routable")
+
+// newHTTPClient returns a client that refuses to connect to loopback, private
+// and link-local addresses, so users can't point webhooks at internal
+// services. The check runs on the resolved IP at dial time, which also covers
+// DNS names that resolve to internal addresses.
+func newHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublicIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+		// Redirects could lead anywhere; receivers must answer directly
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified())
+}
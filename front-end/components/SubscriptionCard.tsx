@@ -2,7 +2,7 @@ import Link from "next/link";
 
 interface SubscriptionCardProps {
   subscription: Subscription;
-  onDelete: (id: number) => void;
+  onDelete: (subscription: Subscription) => void;
 }
 
 export default function SubscriptionCard({
@@ -66,7 +66,7 @@ export default function SubscriptionCard({
         </Link>
         <button
           type="button"
-          onClick={() => onDelete(subscription.id)}
+          onClick={() => onDelete(subscription)}
           className="cursor-pointer px-3 py-1 bg-red-100 dark:bg-red-900 text-red-700 dark:text-red-200 rounded-md text-sm hover:bg-red-200 dark:hover:bg-red-800 transition-colors"
         >
           Delete
@@ -2,11 +2,14 @@ import { clearAuthData, setAuthData } from "@/services/authSlice";
 import { RootState } from "@/services/store";
 import {
   useAuthGoogleMutation,
+  useBeginPasskeyLoginMutation,
+  useFinishPasskeyLoginMutation,
   useGetAccessTokenQuery,
   useGetUserDetailQuery,
   useLoginMutation,
   useLogOutMutation,
   useRegisterMutation,
+  useVerifyLoginChallengeMutation,
 } from "@/services/user";
 import { CodeResponse } from "@react-oauth/google";
 import { useRouter } from "next/router";
@@ -27,6 +30,9 @@ interface AuthContextType {
   setUser: Dispatch<SetStateAction<User | undefined>>;
   signUp: (name: string, email: string, password: string) => Promise<void>;
   signIn: (email: string, password: string) => Promise<void>;
+  signInWithPasskey: () => Promise<void>;
+  challengeToken: string | undefined;
+  verifyTwoFactor: (code: string) => Promise<void>;
   googleAuthLoginHandler: (
     tokenResponse: Omit<CodeResponse, "error">,
   ) => Promise<void>;
@@ -45,6 +51,9 @@ export function AuthProvider({ children }: AuthProviderProps) {
   const [handleLogin] = useLoginMutation();
   const [handleRegister] = useRegisterMutation();
   const [handleLogout] = useLogOutMutation();
+  const [handleVerifyLoginChallenge] = useVerifyLoginChallengeMutation();
+  const [handleBeginPasskeyLogin] = useBeginPasskeyLoginMutation();
+  const [handleFinishPasskeyLogin] = useFinishPasskeyLoginMutation();
   const dispatch = useDispatch();
   const { token } = useSelector((state: RootState) => state.auth);
 
@@ -57,6 +66,9 @@ export function AuthProvider({ children }: AuthProviderProps) {
   }, [dispatch, data]);
 
   const [user, setUser] = useState<User | undefined>(undefined);
+  const [challengeToken, setChallengeToken] = useState<string | undefined>(
+    undefined,
+  );
 
   const { data: userDetail } = useGetUserDetailQuery(undefined, {
     skip: !!user || (!token && token != ""),
@@ -115,6 +127,103 @@ export function AuthProvider({ children }: AuthProviderProps) {
       throw new Error("Failed to login");
     }
 
+    // Accounts with two-factor authentication still need a code
+    if ("challengeToken" in response.data) {
+      setChallengeToken(response.data.challengeToken);
+      router.push("/two-factor");
+      return;
+    }
+
+    setUser(response.data.user);
+    dispatch(setAuthData({ token: response.data.token }));
+
+    router.push("/dashboard");
+  };
+
+  const signInWithPasskey = async () => {
+    toast.promise(signInWithPasskeyHandler(), {
+      loading: "Waiting for your passkey...",
+      success: <b>Success</b>,
+      error: (err) => <b>{err.message}</b>,
+    });
+  };
+
+  const signInWithPasskeyHandler = async () => {
+    if (
+      typeof PublicKeyCredential === "undefined" ||
+      !("parseRequestOptionsFromJSON" in PublicKeyCredential)
+    ) {
+      throw new Error("This browser does not support passkeys");
+    }
+
+    const ceremony = await handleBeginPasskeyLogin();
+    if (ceremony.error) {
+      console.error("Failed to start passkey sign-in: ", ceremony.error);
+
+      if ("status" in ceremony.error && ceremony.error.status === 429) {
+        throw new Error("Too many attempts, try again later");
+      }
+      throw new Error("Failed to login");
+    }
+
+    let credential: Credential | null;
+    try {
+      credential = await navigator.credentials.get({
+        publicKey: PublicKeyCredential.parseRequestOptionsFromJSON(
+          ceremony.data.options.publicKey,
+        ),
+      });
+    } catch (error) {
+      console.error("Passkey prompt failed: ", error);
+      throw new Error("Passkey sign-in was cancelled");
+    }
+    if (!(credential instanceof PublicKeyCredential)) {
+      throw new Error("Passkey sign-in was cancelled");
+    }
+
+    const response = await handleFinishPasskeyLogin({
+      ceremonyId: ceremony.data.ceremonyId,
+      credential: credential.toJSON(),
+    });
+
+    if (response.error) {
+      console.error("Failed to login with passkey: ", response.error);
+
+      throw new Error("Passkey sign-in failed");
+    }
+
+    setUser(response.data.user);
+    dispatch(setAuthData({ token: response.data.token }));
+
+    router.push("/dashboard");
+  };
+
+  const verifyTwoFactor = async (code: string) => {
+    toast.promise(verifyTwoFactorHandler(code), {
+      loading: "Loading...",
+      success: <b>Success</b>,
+      error: (err) => <b>{err.message}</b>,
+    });
+  };
+
+  const verifyTwoFactorHandler = async (code: string) => {
+    if (!challengeToken) {
+      router.push("/login");
+      throw new Error("Please sign in again");
+    }
+
+    const response = await handleVerifyLoginChallenge({ challengeToken, code });
+
+    if (response.error) {
+      console.error("Failed to verify code: ", response.error);
+
+      if ("status" in response.error && response.error.status === 429) {
+        throw new Error("Too many attempts, try again later");
+      }
+      throw new Error("Invalid or expired code");
+    }
+
+    setChallengeToken(undefined);
     setUser(response.data.user);
     dispatch(setAuthData({ token: response.data.token }));
 
@@ -143,6 +252,12 @@ export function AuthProvider({ children }: AuthProviderProps) {
         return;
       }
 
+      if ("challengeToken" in response.data) {
+        setChallengeToken(response.data.challengeToken);
+        router.push("/two-factor");
+        return;
+      }
+
       toast.success(response.data.message);
       dispatch(setAuthData({ token: response.data.token }));
       setUser(response.data.user);
@@ -166,6 +281,9 @@ export function AuthProvider({ children }: AuthProviderProps) {
     setUser,
     signUp,
     signIn,
+    signInWithPasskey,
+    challengeToken,
+    verifyTwoFactor,
     googleAuthLoginHandler,
     logout,
   };
@@ -0,0 +1,65 @@
+import { useEffect, useRef, useState } from "react";
+import Link from "next/link";
+import { useRouter } from "next/router";
+import { useConfirmEmailChangeMutation } from "@/services/user";
+
+type Status = "verifying" | "verified" | "failed";
+
+export default function ConfirmEmail() {
+  const router = useRouter();
+  const [confirmEmailChange] = useConfirmEmailChangeMutation();
+  const [status, setStatus] = useState<Status>("verifying");
+  const submitted = useRef(false);
+
+  useEffect(() => {
+    if (!router.isReady || submitted.current) return;
+
+    const { token } = router.query;
+    if (typeof token !== "string" || token === "") {
+      setStatus("failed");
+      return;
+    }
+
+    submitted.current = true;
+    confirmEmailChange(token)
+      .unwrap()
+      .then(() => setStatus("verified"))
+      .catch(() => setStatus("failed"));
+  }, [router.isReady, router.query, confirmEmailChange]);
+
+  const messages: Record<Status, { title: string; body: string }> = {
+    verifying: {
+      title: "Confirming your new email...",
+      body: "This only takes a moment.",
+    },
+    verified: {
+      title: "Email changed",
+      body: "Your account now uses this address, and reminders will be sent to it.",
+    },
+    failed: {
+      title: "Confirmation failed",
+      body: "This link is invalid, has expired or was already used, or another account uses this address.",
+    },
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 dark:bg-gray-900 py-12 px-4 sm:px-6 lg:px-8 transition-colors duration-200">
+      <div className="max-w-md w-full space-y-6 text-center">
+        <h2 className="text-3xl font-extrabold text-gray-900 dark:text-white">
+          {messages[status].title}
+        </h2>
+        <p className="text-sm text-gray-600 dark:text-gray-400">
+          {messages[status].body}
+        </p>
+        {status !== "verifying" && (
+          <Link
+            href="/dashboard"
+            className="inline-block font-medium text-indigo-600 dark:text-indigo-400 hover:text-indigo-500 dark:hover:text-indigo-300 transition-colors"
+          >
+            Go to Dashboard
+          </Link>
+        )}
+      </div>
+    </div>
+  );
+}
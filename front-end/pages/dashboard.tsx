@@ -34,10 +34,13 @@ export default function Dashboard() {
     }
   }, [isLoading, statsIsLoading]);
 
-  const deleteHandler = (id: number) => {
+  const deleteHandler = (subscription: Subscription) => {
     toast.promise(
       async () => {
-        const response = await handleDelete(id);
+        const response = await handleDelete({
+          id: subscription.id,
+          version: subscription.version,
+        });
 
         if (response.error) {
           console.error("Failed to register: ", response.error);
@@ -0,0 +1,73 @@
+import { useState } from "react";
+import Link from "next/link";
+import toast from "react-hot-toast";
+import FormInput from "@/components/FormInput";
+import { useForgotPasswordMutation } from "@/services/user";
+
+export default function ForgotPassword() {
+  const [email, setEmail] = useState("");
+  const [sent, setSent] = useState(false);
+  const [forgotPassword, { isLoading }] = useForgotPasswordMutation();
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (email.trim() === "") return toast.error("Please enter your email");
+
+    const response = await forgotPassword(email.trim());
+    if (response.error) {
+      return toast.error("Could not send a reset link, please try again later");
+    }
+
+    setSent(true);
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 dark:bg-gray-900 py-12 px-4 sm:px-6 lg:px-8 transition-colors duration-200">
+      <div className="max-w-md w-full space-y-8">
+        <div>
+          <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-900 dark:text-white">
+            Reset your password
+          </h2>
+          <p className="mt-2 text-center text-sm text-gray-600 dark:text-gray-400">
+            Remembered it?{" "}
+            <Link
+              href="/login"
+              className="font-medium text-indigo-600 dark:text-indigo-400 hover:text-indigo-500 dark:hover:text-indigo-300 transition-colors"
+            >
+              Sign in
+            </Link>
+          </p>
+        </div>
+
+        {sent ? (
+          <p className="text-center text-sm text-gray-600 dark:text-gray-400">
+            If an account uses {email.trim()}, we have sent it a link to
+            choose a new password. The link expires in 30 minutes.
+          </p>
+        ) : (
+          <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+            <FormInput
+              id="email-address"
+              name="email"
+              type="email"
+              autoComplete="email"
+              required
+              label="Email address"
+              placeholder="Email address"
+              value={email}
+              onChange={(e) => setEmail(e.target.value)}
+            />
+
+            <button
+              type="submit"
+              disabled={isLoading}
+              className="cursor-pointer w-full flex justify-center py-3 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 disabled:opacity-50 disabled:cursor-not-allowed transition-colors duration-200"
+            >
+              {isLoading ? "Processing..." : "Send reset link"}
+            </button>
+          </form>
+        )}
+      </div>
+    </div>
+  );
+}
@@ -1,4 +1,5 @@
 import { useState } from "react";
+import Link from "next/link";
 import { useAuth } from "@/contexts/AuthContext";
 import AuthForm from "@/components/AuthForm";
 import FormInput from "@/components/FormInput";
@@ -14,7 +15,7 @@ export default function Login() {
   const [error, setError] = useState("");
   const [isLoading, setIsLoading] = useState(false);
 
-  const { signIn } = useAuth();
+  const { signIn, signInWithPasskey } = useAuth();
 
   const handleSubmit = async () => {
     if (email.trim() === "") return setError("Please enter you email");
@@ -105,14 +106,23 @@ export default function Login() {
         />
       </div>
 
-      <div className="flex items-center justify-end">
+      <div className="flex items-center justify-between">
         <div className="text-sm">
-          <a
-            href="#"
+          <button
+            type="button"
+            onClick={signInWithPasskey}
+            className="cursor-pointer font-medium text-indigo-600 dark:text-indigo-400 hover:text-indigo-500 dark:hover:text-indigo-300 transition-colors"
+          >
+            Sign in with a passkey
+          </button>
+        </div>
+        <div className="text-sm">
+          <Link
+            href="/forgot-password"
             className="font-medium text-indigo-600 dark:text-indigo-400 hover:text-indigo-500 dark:hover:text-indigo-300 transition-colors"
           >
             Forgot your password?
-          </a>
+          </Link>
         </div>
       </div>
     </AuthForm>
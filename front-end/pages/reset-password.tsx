@@ -0,0 +1,78 @@
+import { useState } from "react";
+import { useRouter } from "next/router";
+import toast from "react-hot-toast";
+import PasswordInput from "@/components/PasswordInput";
+import { useResetPasswordMutation } from "@/services/user";
+
+export default function ResetPassword() {
+  const router = useRouter();
+  const [password, setPassword] = useState("");
+  const [confirmPassword, setConfirmPassword] = useState("");
+  const [resetPassword, { isLoading }] = useResetPasswordMutation();
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+
+    const { token } = router.query;
+    if (typeof token !== "string" || token === "") {
+      return toast.error("This reset link is invalid");
+    }
+    if (password.length < 8)
+      return toast.error("Password must be at least 8 characters");
+    if (password !== confirmPassword)
+      return toast.error("Passwords do not match");
+
+    const response = await resetPassword({ token, password });
+    if (response.error) {
+      if ("status" in response.error && response.error.status === 422) {
+        return toast.error(
+          "Password must contain at least one letter and one digit",
+        );
+      }
+      return toast.error(
+        "This reset link is invalid, expired or was already used",
+      );
+    }
+
+    toast.success("Password reset, please sign in");
+    router.push("/login");
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 dark:bg-gray-900 py-12 px-4 sm:px-6 lg:px-8 transition-colors duration-200">
+      <div className="max-w-md w-full space-y-8">
+        <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-900 dark:text-white">
+          Choose a new password
+        </h2>
+
+        <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+          <div className="space-y-4">
+            <PasswordInput
+              label="New password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              required
+            />
+            <PasswordInput
+              id="confirm-password"
+              name="confirm-password"
+              label="Confirm new password"
+              placeholder="Confirm password"
+              value={confirmPassword}
+              onChange={(e) => setConfirmPassword(e.target.value)}
+              required
+            />
+          </div>
+
+          <button
+            type="submit"
+            disabled={isLoading}
+            className="cursor-pointer w-full flex justify-center py-3 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 disabled:opacity-50 disabled:cursor-not-allowed transition-colors duration-200"
+          >
+            {isLoading ? "Processing..." : "Reset password"}
+          </button>
+        </form>
+      </div>
+    </div>
+  );
+}
@@ -19,7 +19,7 @@ export default function EditSubscription() {
       async () => {
         const response = await handleUpdate({
           id: Number(id),
-          body: requestData,
+          body: { ...requestData, version: data?.version },
         });
 
         if (response.error) {
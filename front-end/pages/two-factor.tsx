@@ -0,0 +1,75 @@
+import { useEffect, useState } from "react";
+import Link from "next/link";
+import { useRouter } from "next/router";
+import toast from "react-hot-toast";
+import { useAuth } from "@/contexts/AuthContext";
+import FormInput from "@/components/FormInput";
+
+export default function TwoFactor() {
+  const router = useRouter();
+  const { challengeToken, verifyTwoFactor } = useAuth();
+  const [code, setCode] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  // The challenge only lives in memory, so a reload starts over
+  useEffect(() => {
+    if (!challengeToken) router.replace("/login");
+  }, [challengeToken, router]);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (code.trim() === "") return toast.error("Please enter a code");
+
+    setIsLoading(true);
+    await verifyTwoFactor(code.trim());
+    setIsLoading(false);
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 dark:bg-gray-900 py-12 px-4 sm:px-6 lg:px-8 transition-colors duration-200">
+      <div className="max-w-md w-full space-y-8">
+        <div>
+          <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-900 dark:text-white">
+            Two-factor authentication
+          </h2>
+          <p className="mt-2 text-center text-sm text-gray-600 dark:text-gray-400">
+            Enter the 6 digit code from your authenticator app, or one of your
+            recovery codes.
+          </p>
+        </div>
+
+        <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+          <FormInput
+            id="code"
+            name="code"
+            type="text"
+            autoComplete="one-time-code"
+            autoFocus
+            required
+            label="Authentication code"
+            placeholder="123456"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+          />
+
+          <button
+            type="submit"
+            disabled={isLoading}
+            className="cursor-pointer w-full flex justify-center py-3 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 disabled:opacity-50 disabled:cursor-not-allowed transition-colors duration-200"
+          >
+            {isLoading ? "Processing..." : "Verify"}
+          </button>
+        </form>
+
+        <p className="text-center text-sm text-gray-600 dark:text-gray-400">
+          <Link
+            href="/login"
+            className="font-medium text-indigo-600 dark:text-indigo-400 hover:text-indigo-500 dark:hover:text-indigo-300 transition-colors"
+          >
+            Back to sign in
+          </Link>
+        </p>
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,65 @@
+import { useEffect, useRef, useState } from "react";
+import Link from "next/link";
+import { useRouter } from "next/router";
+import { useVerifyEmailMutation } from "@/services/user";
+
+type Status = "verifying" | "verified" | "failed";
+
+export default function VerifyEmail() {
+  const router = useRouter();
+  const [verifyEmail] = useVerifyEmailMutation();
+  const [status, setStatus] = useState<Status>("verifying");
+  const submitted = useRef(false);
+
+  useEffect(() => {
+    if (!router.isReady || submitted.current) return;
+
+    const { token } = router.query;
+    if (typeof token !== "string" || token === "") {
+      setStatus("failed");
+      return;
+    }
+
+    submitted.current = true;
+    verifyEmail(token)
+      .unwrap()
+      .then(() => setStatus("verified"))
+      .catch(() => setStatus("failed"));
+  }, [router.isReady, router.query, verifyEmail]);
+
+  const messages: Record<Status, { title: string; body: string }> = {
+    verifying: {
+      title: "Verifying your email...",
+      body: "This only takes a moment.",
+    },
+    verified: {
+      title: "Email verified",
+      body: "You will now receive reminders before your subscriptions renew.",
+    },
+    failed: {
+      title: "Verification failed",
+      body: "This link is invalid or has expired. Sign in to request a new one.",
+    },
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 dark:bg-gray-900 py-12 px-4 sm:px-6 lg:px-8 transition-colors duration-200">
+      <div className="max-w-md w-full space-y-6 text-center">
+        <h2 className="text-3xl font-extrabold text-gray-900 dark:text-white">
+          {messages[status].title}
+        </h2>
+        <p className="text-sm text-gray-600 dark:text-gray-400">
+          {messages[status].body}
+        </p>
+        {status !== "verifying" && (
+          <Link
+            href="/dashboard"
+            className="inline-block font-medium text-indigo-600 dark:text-indigo-400 hover:text-indigo-500 dark:hover:text-indigo-300 transition-colors"
+          >
+            Go to Dashboard
+          </Link>
+        )}
+      </div>
+    </div>
+  );
+}
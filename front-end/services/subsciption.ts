@@ -35,10 +35,11 @@ export const subscriptionApi = createApi({
       }),
       invalidatesTags: ["sub"],
     }),
-    deleteSub: build.mutation<void, number>({
-      query: (id) => ({
+    deleteSub: build.mutation<void, { id: number; version: number }>({
+      query: ({ id, version }) => ({
         url: `subscriptions/${id}`,
         method: "DELETE",
+        headers: { "If-Match": `"${version}"` },
       }),
       invalidatesTags: ["sub"],
     }),
@@ -20,7 +20,10 @@ export const userApi = createApi({
         credentials: "include",
       }),
     }),
-    login: build.mutation<AuthResult, { email: string; password: string }>({
+    login: build.mutation<
+      AuthResult | LoginChallenge,
+      { email: string; password: string }
+    >({
       query: ({ email, password }) => ({
         url: "login",
         method: "POST",
@@ -31,7 +34,7 @@ export const userApi = createApi({
         credentials: "include",
       }),
     }),
-    authGoogle: build.mutation<AuthResult, string>({
+    authGoogle: build.mutation<AuthResult | LoginChallenge, string>({
       query: (code) => ({
         url: "auth/google",
         method: "POST",
@@ -41,6 +44,40 @@ export const userApi = createApi({
         credentials: "include",
       }),
     }),
+    verifyLoginChallenge: build.mutation<
+      AuthResult,
+      { challengeToken: string; code: string }
+    >({
+      query: ({ challengeToken, code }) => ({
+        url: "login/2fa",
+        method: "POST",
+        body: {
+          challengeToken,
+          code,
+        },
+        credentials: "include",
+      }),
+    }),
+    beginPasskeyLogin: build.mutation<PasskeyCeremony, void>({
+      query: () => ({
+        url: "passkeys/login/begin",
+        method: "POST",
+      }),
+    }),
+    finishPasskeyLogin: build.mutation<
+      AuthResult,
+      { ceremonyId: string; credential: PublicKeyCredentialJSON }
+    >({
+      query: ({ ceremonyId, credential }) => ({
+        url: "passkeys/login/finish",
+        method: "POST",
+        body: {
+          ceremonyId,
+          credential,
+        },
+        credentials: "include",
+      }),
+    }),
     getUserDetail: build.query<User, void>({
       query: () => ({
         url: "detail",
@@ -53,6 +90,47 @@ export const userApi = createApi({
         credentials: "include",
       }),
     }),
+    verifyEmail: build.mutation<MessageResult, string>({
+      query: (token) => ({
+        url: "verify-email",
+        method: "POST",
+        body: {
+          token,
+        },
+      }),
+    }),
+    forgotPassword: build.mutation<MessageResult, string>({
+      query: (email) => ({
+        url: "password/forgot",
+        method: "POST",
+        body: {
+          email,
+        },
+      }),
+    }),
+    resetPassword: build.mutation<
+      MessageResult,
+      { token: string; password: string }
+    >({
+      query: ({ token, password }) => ({
+        url: "password/reset",
+        method: "POST",
+        body: {
+          token,
+          password,
+        },
+        credentials: "include",
+      }),
+    }),
+    confirmEmailChange: build.mutation<User, string>({
+      query: (token) => ({
+        url: "profile/email/confirm",
+        method: "POST",
+        body: {
+          token,
+        },
+      }),
+    }),
     logOut: build.mutation<void, void>({
       query: () => ({
         url: "logout",
@@ -67,7 +145,14 @@ export const {
   useRegisterMutation,
   useLoginMutation,
   useAuthGoogleMutation,
+  useVerifyLoginChallengeMutation,
+  useBeginPasskeyLoginMutation,
+  useFinishPasskeyLoginMutation,
   useGetUserDetailQuery,
   useGetAccessTokenQuery,
+  useVerifyEmailMutation,
+  useForgotPasswordMutation,
+  useResetPasswordMutation,
+  useConfirmEmailChangeMutation,
   useLogOutMutation,
 } = userApi;
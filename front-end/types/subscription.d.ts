@@ -7,6 +7,7 @@ interface Subscription {
   email?: string;
   category: string;
   isActive?: boolean;
+  version: number;
   createdAt: Date;
   updateAt: Date;
 }
@@ -18,6 +19,7 @@ interface RequestSub {
   billingCycle: string;
   nextBillingDate: string;
   category: string;
+  version?: number;
 }
 
 interface SubStats {
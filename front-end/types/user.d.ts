@@ -2,6 +2,7 @@ interface User {
   id: number;
   name: string;
   email: string;
+  email_verified: boolean;
   createdAt: string;
   updatedAt: string;
 }
@@ -12,7 +13,22 @@ interface AuthResult {
   user: User;
 }
 
+interface LoginChallenge {
+  message: string;
+  challengeToken: string;
+  methods: string[];
+}
+
+interface PasskeyCeremony {
+  ceremonyId: string;
+  options: { publicKey: PublicKeyCredentialRequestOptionsJSON };
+}
+
 interface RefreshResult {
   message: string;
   token: string;
 }
+
+interface MessageResult {
+  message: string;
+}